@@ -1,10 +1,9 @@
 package cmd
 
 import (
-	"bufio"
+	"fmt"
 	"log/slog"
 	"os"
-	"path"
 	"strings"
 
 	"github.com/peng225/silkroad/internal/dot"
@@ -13,12 +12,31 @@ import (
 )
 
 var (
-	rootPath        string
-	outputFileName  string
-	ignoreExternal  bool
-	goModPath       string
-	packagePatterns []string
-	verbose         bool
+	rootPath           string
+	outputFileName     string
+	ignoreExternal     bool
+	hideStdlib         bool
+	hideThirdParty     bool
+	externalDepth      int
+	includeFuncs       bool
+	includeLocalTypes  bool
+	includeCalls       bool
+	includeVars        bool
+	includeConstructs  bool
+	includeAsserts     bool
+	includeUsedAs      bool
+	showPromotion      bool
+	includeTests       bool
+	tags               []string
+	platforms          []string
+	externalImplements bool
+	externalInterfaces []string
+	errorView          bool
+	goModPath          string
+	packagePatterns    []string
+	level              string
+	verbose            bool
+	reportIncidental   bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -33,47 +51,83 @@ This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if level != "type" && level != "package" && level != "import" {
+			return fmt.Errorf("invalid level: %s", level)
+		}
+		for _, platform := range platforms {
+			goos, goarch, ok := strings.Cut(platform, "/")
+			if !ok || goos == "" || goarch == "" {
+				return fmt.Errorf("invalid platform: %s", platform)
+			}
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		moduleName := ""
 		var err error
-		moduleName, err = getModuleName(path.Join(goModPath, "go.mod"))
-		if err != nil {
-			panic(err)
+		opts := graph.Options{
+			HideStdlib:         hideStdlib || ignoreExternal,
+			HideThirdParty:     hideThirdParty || ignoreExternal,
+			ExternalDepth:      externalDepth,
+			IncludeFuncs:       includeFuncs,
+			IncludeLocalTypes:  includeLocalTypes,
+			IncludeCalls:       includeCalls,
+			IncludeVars:        includeVars,
+			IncludeConstructs:  includeConstructs,
+			IncludeAsserts:     includeAsserts,
+			IncludeUsedAs:      includeUsedAs,
+			ShowPromotion:      showPromotion,
+			IncludeTests:       includeTests,
+			Tags:               tags,
+			ExternalImplements: externalImplements || len(externalInterfaces) != 0,
+			ExternalInterfaces: externalInterfaces,
+			ErrorView:          errorView,
+			PackagePatterns:    packagePatterns,
 		}
-		tg := graph.NewTypeGraph(ignoreExternal, moduleName, packagePatterns)
-		err = tg.Build(rootPath)
-		if err != nil {
-			panic(err)
+		var tg *graph.TypeGraph
+		if len(platforms) == 0 {
+			tg = graph.NewTypeGraph(opts)
+			err = tg.Build(rootPath)
+			if err != nil {
+				panic(err)
+			}
+		} else {
+			// Build the graph for each platform, and merge them.
+			graphs := []*graph.TypeGraph{}
+			for _, platform := range platforms {
+				opts.Platform = platform
+				g := graph.NewTypeGraph(opts)
+				err = g.Build(rootPath)
+				if err != nil {
+					panic(err)
+				}
+				graphs = append(graphs, g)
+			}
+			tg = graph.Merge(platforms, graphs)
 		}
 		if verbose {
 			tg.Dump()
 		}
-		err = dot.WriteToFile(tg, outputFileName)
+		if reportIncidental {
+			fmt.Println("Incidental implementations:")
+			for _, impl := range tg.IncidentalImplementations() {
+				fmt.Printf("  %s -> %s\n", impl[0], impl[1])
+			}
+		}
+		switch level {
+		case "type":
+			err = dot.WriteToFile(tg, outputFileName)
+		case "package":
+			err = dot.WritePackageGraphToFile(tg, outputFileName)
+		case "import":
+			err = dot.WriteImportGraphToFile(tg, outputFileName)
+		}
 		if err != nil {
 			slog.Error("Failed to output a dot file.", "err", err.Error())
 		}
 	},
 }
 
-func getModuleName(goModFilePath string) (string, error) {
-	f, err := os.Open(goModFilePath)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "module ") {
-			tokens := strings.Split(line, " ")
-			return tokens[len(tokens)-1], nil
-		}
-	}
-	return "", nil
-}
-
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -94,10 +148,30 @@ func init() {
 	// when this action is called directly.
 	rootCmd.Flags().StringVarP(&rootPath, "path", "p", ".", "The path to the root directory for which the analysis runs.")
 	rootCmd.Flags().StringVarP(&outputFileName, "output", "o", ".", "The output dot file name.")
-	rootCmd.Flags().BoolVar(&ignoreExternal, "ignore-external", false, "Ignore types imported from the external modules.")
+	rootCmd.Flags().BoolVar(&ignoreExternal, "ignore-external", false, "Ignore types imported from the external modules. Same as --hide-stdlib --hide-third-party.")
+	rootCmd.Flags().BoolVar(&hideStdlib, "hide-stdlib", false, "Ignore types in the standard library.")
+	rootCmd.Flags().BoolVar(&hideThirdParty, "hide-third-party", false, "Ignore types in the third-party modules.")
+	rootCmd.Flags().IntVar(&externalDepth, "external-depth", 1, "Keep types in the third-party modules only within N hops from the internal types. 1 keeps the directly referenced ones, and the larger values follow the types in their definitions. Negative means no limit.")
+	rootCmd.Flags().BoolVar(&includeFuncs, "include-funcs", false, "Include package-level functions as nodes.")
+	rootCmd.Flags().BoolVar(&includeLocalTypes, "include-local-types", false, "Include types declared in function bodies.")
+	rootCmd.Flags().BoolVar(&includeCalls, "include-calls", false, "Add Calls edges between types built from the call graph.")
+	rootCmd.Flags().BoolVar(&includeVars, "include-vars", false, "Include package-level variables and constants as nodes.")
+	rootCmd.Flags().BoolVar(&includeConstructs, "include-constructs", false, "Include Constructs edges from composite literals, new and make in function bodies.")
+	rootCmd.Flags().BoolVar(&includeAsserts, "include-asserts", false, "Include AssertsTo edges from type assertions and type switches in function bodies.")
+	rootCmd.Flags().BoolVar(&includeUsedAs, "include-used-as", false, "Include UsedAs edges for the implicit conversions from concrete types to interfaces.")
+	rootCmd.Flags().BoolVar(&showPromotion, "show-promotion", false, "Show the embedded fields whose promoted methods make a type implement an interface.")
+	rootCmd.Flags().BoolVar(&includeTests, "tests", false, "Include the test files and the external test packages.")
+	rootCmd.Flags().StringSliceVar(&tags, "tags", []string{}, "Build tags. e.g. 'integration,linux'")
+	rootCmd.Flags().StringSliceVar(&platforms, "platforms", []string{}, "Target platforms. The graphs for them are merged. e.g. 'linux/amd64,windows/arm64'")
+	rootCmd.Flags().BoolVar(&externalImplements, "external-implements", false, "Include Implements edges toward the external interfaces referenced by the code.")
+	rootCmd.Flags().StringSliceVar(&externalInterfaces, "external-interfaces", []string{}, "Additional external interfaces for --external-implements. Implies it. e.g. 'io.Writer,error,net/http.Handler'")
+	rootCmd.Flags().BoolVar(&errorView, "errors", false, "Mark the types implementing error, and include Wraps and ReturnsError edges.")
 	rootCmd.Flags().StringVar(&goModPath, "go-mod-path", "", "The path to the directory where go.mod file exists.")
+	rootCmd.Flags().StringVar(&level, "level", "type", "The granularity of the nodes. 'type', 'package' or 'import'.")
+	rootCmd.Flags().BoolVar(&reportIncidental, "report-incidental", false, "Report the types implementing the interfaces in the module without a compile-time assertion.")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose mode.")
 	rootCmd.Flags().StringSliceVar(&packagePatterns, "package-pattern", []string{"./..."}, "Package patterns. e.g. 'bytes,unicode...'")
 
-	rootCmd.MarkFlagsRequiredTogether("ignore-external", "go-mod-path")
+	// The modules are detected from the loaded packages and go.work.
+	rootCmd.Flags().MarkDeprecated("go-mod-path", "the modules are detected automatically.")
 }
@@ -6,12 +6,12 @@ toolchain go1.23.3
 
 require (
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/mod v0.25.0
 	golang.org/x/tools v0.34.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/mod v0.25.0 // indirect
 	golang.org/x/sync v0.15.0 // indirect
 )
@@ -4,12 +4,17 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/peng225/silkroad/internal/graph"
 )
 
+// errorFillColor is the fill color for the types implementing error.
+const errorFillColor = "lightsalmon"
+
 type nodeStyle struct {
 	shape     string
 	fillColor string
@@ -56,22 +61,105 @@ func WriteToFile(tg *graph.TypeGraph, fileName string) error {
 				},
 			})
 	}
+	for pkg, nodes := range tg.FuncNodes() {
+		pkgToNodesWithStyleList[pkg] = append(pkgToNodesWithStyleList[pkg],
+			nodesWithStyle{
+				nodes: nodes,
+				ns: nodeStyle{
+					shape:     "component",
+					fillColor: "lightgoldenrod1",
+				},
+			})
+	}
+	for pkg, nodes := range tg.VarNodes() {
+		pkgToNodesWithStyleList[pkg] = append(pkgToNodesWithStyleList[pkg],
+			nodesWithStyle{
+				nodes: nodes,
+				ns: nodeStyle{
+					shape:     "note",
+					fillColor: "honeydew",
+				},
+			})
+	}
+	localTypes := tg.LocalTypes()
+	testNodes := tg.TestNodes()
+	errorNodes := tg.ErrorNodes()
+	// The predeclared types (e.g. comparable, error) do not belong to any package.
+	// They are all interfaces.
+	for id := range tg.PredeclaredNodes() {
+		fillColor := "plum1"
+		if _, ok := errorNodes[id]; ok {
+			fillColor = errorFillColor
+		}
+		data += fmt.Sprintf("\"%s\" [label=\"%s\" shape=\"hexagon\" fillcolor=\"%s\"];\n",
+			id, id, fillColor)
+	}
 	for pkg, nwsList := range pkgToNodesWithStyleList {
-		sanitizedPkg := strings.Replace(
-			strings.Replace(
-				strings.Replace(pkg, ".", "_", -1),
-				"/", "_", -1),
-			"-", "_", -1)
+		sanitizedPkg := sanitize(pkg)
 		data += fmt.Sprintf("subgraph cluster_%s {\n", sanitizedPkg)
 		data += fmt.Sprintf("  label = \"%s\";\n", pkg)
 		data += "  style = \"solid\";\n"
-		data += "  bgcolor = \"cornsilk\";\n"
+		if strings.HasSuffix(pkg, "_test") {
+			// External test package.
+			data += "  bgcolor = \"mistyrose\";\n"
+		} else {
+			data += fmt.Sprintf("  bgcolor = \"%s\";\n", classColor(tg.ClassOf(pkg)))
+		}
+		// The types in the packages which are not loaded are drawn faded.
+		nodeExtra := ""
+		if tg.IsReferencedOnly(pkg) {
+			data += "  color = \"gray60\";\n"
+			data += "  fontcolor = \"gray40\";\n"
+			nodeExtra = " color=\"gray60\" fontcolor=\"gray40\""
+		}
+		// Function-local types are drawn in the sub-cluster for each function.
+		funcToNodes := map[string]([]string){}
+		// Types in the in-package test files are drawn in the test sub-cluster.
+		inPackageTestNodes := []string{}
 		for _, nws := range nwsList {
 			for _, obj := range nws.nodes {
-				data += fmt.Sprintf("  \"%s.%s\" [label=\"%s\" shape=\"%s\" fillcolor=\"%s\"];\n",
-					pkg, obj, obj, nws.ns.shape, nws.ns.fillColor)
+				fillColor := nws.ns.fillColor
+				if _, ok := errorNodes[pkg+"."+obj]; ok {
+					fillColor = errorFillColor
+				}
+				if f, ok := localTypes[pkg+"."+obj]; ok {
+					funcToNodes[f] = append(funcToNodes[f],
+						fmt.Sprintf("    \"%s.%s\" [label=\"%s\" shape=\"%s\" fillcolor=\"%s\"%s];\n",
+							pkg, obj, labelWithPlatforms(strings.TrimPrefix(obj, f+"."), tg.NodePlatforms(pkg+"."+obj)),
+							nws.ns.shape, fillColor, nodeExtra))
+					continue
+				}
+				if _, ok := testNodes[pkg+"."+obj]; ok && !strings.HasSuffix(pkg, "_test") {
+					inPackageTestNodes = append(inPackageTestNodes,
+						fmt.Sprintf("    \"%s.%s\" [label=\"%s\" shape=\"%s\" fillcolor=\"%s\"%s];\n",
+							pkg, obj, labelWithPlatforms(obj, tg.NodePlatforms(pkg+"."+obj)),
+							nws.ns.shape, fillColor, nodeExtra))
+					continue
+				}
+				data += fmt.Sprintf("  \"%s.%s\" [label=\"%s\" shape=\"%s\" fillcolor=\"%s\"%s];\n",
+					pkg, obj, labelWithPlatforms(obj, tg.NodePlatforms(pkg+"."+obj)),
+					nws.ns.shape, fillColor, nodeExtra)
 			}
 		}
+		if len(inPackageTestNodes) != 0 {
+			data += fmt.Sprintf("  subgraph cluster_%s_testfiles {\n", sanitizedPkg)
+			data += "    label = \"test\";\n"
+			data += "    style = \"dashed\";\n"
+			data += "    bgcolor = \"mistyrose\";\n"
+			for _, node := range inPackageTestNodes {
+				data += node
+			}
+			data += "  }\n"
+		}
+		for f, nodes := range funcToNodes {
+			data += fmt.Sprintf("  subgraph cluster_%s_%s {\n", sanitizedPkg, sanitize(f))
+			data += fmt.Sprintf("    label = \"%s\";\n", f)
+			data += "    style = \"dashed\";\n"
+			for _, node := range nodes {
+				data += node
+			}
+			data += "  }\n"
+		}
 		data += "}\n"
 	}
 
@@ -79,29 +167,216 @@ func WriteToFile(tg *graph.TypeGraph, fileName string) error {
 		for edge, _ := range edges {
 			label := ""
 			arrowHead := "normal"
+			arrowTail := ""
 			style := "solid"
+			// extra is the additional attributes. (e.g. ` tooltip="..."`)
+			extra := ""
 			switch edge.Kind {
 			case graph.Has:
-				label = "Has"
+				// UML style: composition for values and aggregation for references.
+				label = fmt.Sprintf("%s [%s]", edge.Field, multiplicityLabel(edge.Multiplicity))
+				arrowTail = "odiamond"
+				if edge.Multiplicity == graph.One {
+					arrowTail = "diamond"
+				}
 			case graph.Implements:
 				label = "Implements"
+				details := []string{}
+				if edge.PointerOnly {
+					details = append(details, "pointer")
+				}
+				if edge.Via != "" {
+					details = append(details, "via "+edge.Via)
+					extra = fmt.Sprintf(" tooltip=\"promoted: %s\"", edge.Label)
+				}
+				if len(details) != 0 {
+					label = fmt.Sprintf("%s (%s)", label, strings.Join(details, ", "))
+				}
 				arrowHead = "empty"
 				style = "dashed"
+				if edge.Asserted {
+					style = "bold"
+				}
 			case graph.Embeds:
 				label = "Embeds"
 				arrowHead = "empty"
-			case graph.UsesAsAlias:
-				label = "UsesAsAlias"
+			case graph.DefinedFrom:
+				label = "DefinedFrom"
+				style = "dashed"
+			case graph.Accepts:
+				label = labelWithDetail("Accepts", edge.Label)
+				arrowHead = "open"
+				style = "dotted"
+			case graph.Returns:
+				label = labelWithDetail("Returns", edge.Label)
+				arrowHead = "vee"
+				style = "dotted"
+			case graph.Instantiates:
+				label = labelWithDetail("Instantiates", edge.Label)
+				arrowHead = "onormal"
+			case graph.ConstrainedBy:
+				label = labelWithDetail("ConstrainedBy", edge.Label)
+				arrowHead = "odiamond"
+				style = "dashed"
+			case graph.AliasOf:
+				label = "AliasOf"
+				arrowHead = "odot"
+				style = "bold"
+			case graph.Calls:
+				label = "Calls"
+				arrowHead = "veevee"
+			case graph.Declares:
+				label = "Declares"
+				arrowHead = "open"
 				style = "dashed"
+			case graph.Constructs:
+				label = labelWithDetail("Constructs", edge.Label)
+				arrowHead = "dot"
+			case graph.AssertsTo:
+				label = labelWithDetail("AssertsTo", edge.Label)
+				arrowHead = "inv"
+				style = "dashed"
+			case graph.Wraps:
+				label = "Wraps"
+				arrowHead = "box"
+				style = "bold"
+			case graph.ReturnsError:
+				label = labelWithDetail("ReturnsError", edge.Label)
+				arrowHead = "vee"
+				style = "dashed"
+			case graph.UsedAs:
+				sites := tg.UsedAsSites(from, edge.To)
+				label = labelWithDetail("UsedAs", fmt.Sprintf("%d sites", len(sites)))
+				arrowHead = "empty"
+				style = "dotted"
+				extra = fmt.Sprintf(" tooltip=\"%s\" penwidth=\"%.1f\"",
+					strings.Join(sites, "\\n"), penWidth(len(sites)))
 			default:
 				slog.Warn("Unknown edge kind found", "kind", edge.Kind)
 			}
-			data += fmt.Sprintf("\"%s\" -> \"%s\" [label=\"%s\" arrowhead=\"%s\" style=\"%s\"];\n",
-				from, edge.To, label, arrowHead, style)
+			if edge.Kind == graph.Accepts || edge.Kind == graph.Returns {
+				if edge.Multiplicity != graph.One {
+					label = fmt.Sprintf("%s [%s]", label, multiplicityLabel(edge.Multiplicity))
+				}
+			}
+			if edge.Field != "" && edge.Kind != graph.Has {
+				label = fmt.Sprintf("%s (%s)", label, edge.Field)
+			}
+			label = labelWithPlatforms(label, tg.EdgePlatforms(from, edge))
+			if arrowTail != "" {
+				data += fmt.Sprintf("\"%s\" -> \"%s\" [label=\"%s\" arrowhead=\"%s\" arrowtail=\"%s\" dir=\"both\" style=\"%s\"%s];\n",
+					from, edge.To, label, arrowHead, arrowTail, style, extra)
+				continue
+			}
+			data += fmt.Sprintf("\"%s\" -> \"%s\" [label=\"%s\" arrowhead=\"%s\" style=\"%s\"%s];\n",
+				from, edge.To, label, arrowHead, style, extra)
+		}
+	}
+	data += "}\n"
+
+	return writeFile(fileName, data)
+}
+
+// WritePackageGraphToFile writes the graph in which the types are folded into their packages.
+func WritePackageGraphToFile(tg *graph.TypeGraph, fileName string) error {
+	data := "digraph G {\n"
+	data += "node[style=\"filled\" shape=\"folder\" fillcolor=\"cornsilk\"]\n"
+
+	pkgs := map[string]struct{}{}
+	for _, nodes := range []map[string]([]string){
+		tg.StructNodes(), tg.InterfaceNodes(), tg.OtherNodes(), tg.FuncNodes(), tg.VarNodes(),
+	} {
+		for pkg := range nodes {
+			pkgs[pkg] = struct{}{}
+		}
+	}
+	packageEdges := tg.PackageEdges()
+	for from, edges := range packageEdges {
+		pkgs[from] = struct{}{}
+		for edge := range edges {
+			pkgs[edge.To] = struct{}{}
+		}
+	}
+	for pkg := range pkgs {
+		data += fmt.Sprintf("\"%s\" [fillcolor=\"%s\"];\n", pkg, classColor(tg.ClassOf(pkg)))
+	}
+
+	for from, edges := range packageEdges {
+		toToKinds := map[string]([]string){}
+		toToWeight := map[string]int{}
+		for edge, count := range edges {
+			toToKinds[edge.To] = append(toToKinds[edge.To], fmt.Sprintf("%s: %d", edge.Kind, count))
+			toToWeight[edge.To] += count
+		}
+		for to, kinds := range toToKinds {
+			sort.Strings(kinds)
+			data += fmt.Sprintf("\"%s\" -> \"%s\" [label=\"%s\" weight=\"%d\" penwidth=\"%.1f\"];\n",
+				from, to, strings.Join(kinds, "\\n"), toToWeight[to], penWidth(toToWeight[to]))
+		}
+	}
+	data += "}\n"
+
+	return writeFile(fileName, data)
+}
+
+// WriteImportGraphToFile writes the import graph.
+// The imports from which no type-level edge comes are drawn with dashed lines.
+func WriteImportGraphToFile(tg *graph.TypeGraph, fileName string) error {
+	data := "digraph G {\n"
+	data += "node[style=\"filled\" shape=\"folder\" fillcolor=\"cornsilk\"]\n"
+
+	imports := tg.Imports()
+	pkgs := map[string]struct{}{}
+	for pkg, imps := range imports {
+		pkgs[pkg] = struct{}{}
+		for _, imp := range imps {
+			pkgs[imp] = struct{}{}
+		}
+	}
+	for pkg := range pkgs {
+		data += fmt.Sprintf("\"%s\" [fillcolor=\"%s\"];\n", pkg, classColor(tg.ClassOf(pkg)))
+	}
+
+	packageEdges := tg.PackageEdges()
+	for pkg, imps := range imports {
+		toToWeight := map[string]int{}
+		for edge, count := range packageEdges[pkg] {
+			toToWeight[edge.To] += count
+		}
+		for _, imp := range imps {
+			weight, ok := toToWeight[imp]
+			if !ok {
+				data += fmt.Sprintf("\"%s\" -> \"%s\" [label=\"no type use\" style=\"dashed\" color=\"gray50\"];\n",
+					pkg, imp)
+				continue
+			}
+			data += fmt.Sprintf("\"%s\" -> \"%s\" [label=\"%d\" style=\"solid\" penwidth=\"%.1f\"];\n",
+				pkg, imp, weight, penWidth(weight))
 		}
 	}
 	data += "}\n"
 
+	return writeFile(fileName, data)
+}
+
+// classColor returns the background color for the packages of class c.
+func classColor(c graph.PackageClass) string {
+	switch c {
+	case graph.Stdlib:
+		return "aliceblue"
+	case graph.ThirdParty:
+		return "linen"
+	default:
+		return "cornsilk"
+	}
+}
+
+// penWidth returns the width of the edge which aggregates weight edges.
+func penWidth(weight int) float64 {
+	return math.Min(1+math.Log2(float64(weight)), 8)
+}
+
+func writeFile(fileName, data string) error {
 	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
 	if err != nil {
 		return err
@@ -116,6 +391,48 @@ func WriteToFile(tg *graph.TypeGraph, fileName string) error {
 	return nil
 }
 
+func sanitize(name string) string {
+	return strings.Replace(
+		strings.Replace(
+			strings.Replace(name, ".", "_", -1),
+			"/", "_", -1),
+		"-", "_", -1)
+}
+
+func multiplicityLabel(m graph.Multiplicity) string {
+	switch m {
+	case graph.One:
+		return "1"
+	case graph.ZeroOrOne:
+		return "0..1"
+	case graph.ZeroOrMore:
+		return "0..*"
+	case graph.KeyedZeroOrMore:
+		return "0..* {keyed}"
+	case graph.Channel:
+		return "chan"
+	default:
+		slog.Warn("Unknown multiplicity found", "multiplicity", m)
+		return ""
+	}
+}
+
+func labelWithDetail(label, detail string) string {
+	if detail == "" {
+		return label
+	}
+	return label + ": " + detail
+}
+
+// labelWithPlatforms appends the platforms to label
+// for the nodes and the edges found only on some of the platforms.
+func labelWithPlatforms(label string, platforms []string) string {
+	if len(platforms) == 0 {
+		return label
+	}
+	return fmt.Sprintf("%s\\n{%s}", label, strings.Join(platforms, ", "))
+}
+
 func writeAll(r io.Writer, data []byte) error {
 	tmpData := data
 	for len(tmpData) != 0 {
@@ -0,0 +1,269 @@
+package graph
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+)
+
+// funcBody is a function declaration with the type information of its package.
+// Function bodies are scanned after all nodes are found,
+// because a body may refer to a type declared later.
+type funcBody struct {
+	decl *ast.FuncDecl
+	info *types.Info
+	fset *token.FileSet
+}
+
+// buildBodyEdge builds the edges found in the body of x.
+// The edges start from the receiver type for methods,
+// and from the function itself if it is included in the nodes.
+func (tg *TypeGraph) buildBodyEdge(x *ast.FuncDecl, info *types.Info) {
+	if x.Body == nil {
+		return
+	}
+	from := receiverObj(x, info)
+	if from == nil {
+		from = info.ObjectOf(x.Name)
+	}
+	if from == nil || !tg.isNode(from) {
+		return
+	}
+
+	ast.Inspect(x.Body, func(n ast.Node) bool {
+		switch y := n.(type) {
+		case *ast.CompositeLit:
+			if tg.includeConstructs {
+				tg.addBodyEdge(from, info.TypeOf(y), Constructs)
+			}
+		case *ast.CallExpr:
+			if tg.includeConstructs && len(y.Args) != 0 &&
+				(isBuiltin(y, info, "new") || isBuiltin(y, info, "make")) {
+				tg.addBodyEdge(from, info.TypeOf(y.Args[0]), Constructs)
+			}
+		case *ast.TypeAssertExpr:
+			// y.Type is nil for x.(type) in a type switch.
+			if tg.includeAsserts && y.Type != nil {
+				tg.addBodyEdge(from, info.Types[y.Type].Type, AssertsTo)
+			}
+		case *ast.TypeSwitchStmt:
+			if !tg.includeAsserts {
+				return true
+			}
+			for _, stmt := range y.Body.List {
+				clause, ok := stmt.(*ast.CaseClause)
+				if !ok {
+					continue
+				}
+				for _, expr := range clause.List {
+					tg.addBodyEdge(from, info.Types[expr].Type, AssertsTo)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// addBodyEdge adds an edge from parent to t if t is a named type or a pointer to it,
+// possibly through aliases.
+// For an instantiated generic type, the edge goes to the generic type
+// and is labeled with the instantiation. (e.g. "ST101[ST3]")
+func (tg *TypeGraph) addBodyEdge(parent types.Object, t types.Type, kind EdgeKind) {
+	// An alias (e.g. type A = B) constructs or asserts to the aliased type.
+	t = types.Unalias(t)
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = types.Unalias(ptr.Elem())
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return
+	}
+	obj := named.Origin().Obj()
+	if obj.Pkg() == nil {
+		return
+	}
+	if tg.isHidden(obj) {
+		return
+	}
+	if !tg.includeLocalTypes && tg.isLocal(obj) {
+		return
+	}
+	tg.addReferencedNode(obj)
+	edge := Edge{
+		To:   tg.typeID(obj),
+		Kind: kind,
+	}
+	if named.TypeArgs().Len() != 0 {
+		edge.Label = types.TypeString(named, shortQualifier(parent.Pkg()))
+	}
+	tg.addEdge(tg.typeID(parent), edge)
+}
+
+// isBuiltin returns true if call is a call to the builtin function name.
+func isBuiltin(call *ast.CallExpr, info *types.Info, name string) bool {
+	ident, ok := ast.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	b, ok := info.Uses[ident].(*types.Builtin)
+	return ok && b.Name() == name
+}
+
+// buildUsedAsEdge builds UsedAs edges for the implicit conversions
+// from concrete types to interfaces found in body.
+// sig is the signature of the function whose body is body.
+func (tg *TypeGraph) buildUsedAsEdge(body *ast.BlockStmt, sig *types.Signature,
+	info *types.Info, fset *token.FileSet) {
+	if body == nil {
+		return
+	}
+	addEdge := func(value types.Type, target types.Type, expr ast.Expr) {
+		tg.addUsedAsEdge(value, target, fset.Position(expr.Pos()))
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch y := n.(type) {
+		case *ast.FuncLit:
+			// Returns in a closure belong to the closure.
+			if litSig, ok := info.TypeOf(y).(*types.Signature); ok {
+				tg.buildUsedAsEdge(y.Body, litSig, info, fset)
+			}
+			return false
+		case *ast.AssignStmt:
+			// := never converts, and a single multi-value call on the right
+			// cannot be matched with the left side one by one.
+			if y.Tok != token.ASSIGN || len(y.Lhs) != len(y.Rhs) {
+				return true
+			}
+			for i := range y.Lhs {
+				addEdge(info.TypeOf(y.Rhs[i]), info.TypeOf(y.Lhs[i]), y.Rhs[i])
+			}
+		case *ast.ValueSpec:
+			if y.Type == nil || len(y.Names) != len(y.Values) {
+				return true
+			}
+			for _, value := range y.Values {
+				addEdge(info.TypeOf(value), info.TypeOf(y.Type), value)
+			}
+		case *ast.ReturnStmt:
+			if sig == nil || sig.Results().Len() != len(y.Results) {
+				return true
+			}
+			for i, result := range y.Results {
+				addEdge(info.TypeOf(result), sig.Results().At(i).Type(), result)
+			}
+		case *ast.CallExpr:
+			if tv := info.Types[y.Fun]; tv.IsType() || tv.IsBuiltin() {
+				// Explicit conversions and builtins.
+				return true
+			}
+			callSig, ok := info.TypeOf(y.Fun).Underlying().(*types.Signature)
+			if !ok {
+				return true
+			}
+			params := callSig.Params()
+			for i, arg := range y.Args {
+				var param types.Type
+				switch {
+				case callSig.Variadic() && i >= params.Len()-1:
+					param = params.At(params.Len() - 1).Type()
+					if !y.Ellipsis.IsValid() {
+						param = param.(*types.Slice).Elem()
+					}
+				case i < params.Len():
+					param = params.At(i).Type()
+				default:
+					continue
+				}
+				addEdge(info.TypeOf(arg), param, arg)
+			}
+		case *ast.CompositeLit:
+			t := info.TypeOf(y)
+			if t == nil {
+				return true
+			}
+			switch u := t.Underlying().(type) {
+			case *types.Struct:
+				for i, elt := range y.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if field, ok := info.Uses[kv.Key.(*ast.Ident)].(*types.Var); ok {
+							addEdge(info.TypeOf(kv.Value), field.Type(), kv.Value)
+						}
+						continue
+					}
+					if i < u.NumFields() {
+						addEdge(info.TypeOf(elt), u.Field(i).Type(), elt)
+					}
+				}
+			case *types.Slice, *types.Array, *types.Map:
+				elem := u.(interface{ Elem() types.Type }).Elem()
+				for _, elt := range y.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if m, ok := u.(*types.Map); ok {
+							addEdge(info.TypeOf(kv.Key), m.Key(), kv.Key)
+						}
+						elt = kv.Value
+					}
+					addEdge(info.TypeOf(elt), elem, elt)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// addUsedAsEdge adds a UsedAs edge from value to target
+// if value is a concrete type in the node list (possibly through aliases)
+// and target is an interface.
+// The position of the conversion is recorded as a site of the edge.
+func (tg *TypeGraph) addUsedAsEdge(value, target types.Type, pos token.Position) {
+	if value == nil || target == nil || !types.IsInterface(target) ||
+		types.IsInterface(value) {
+		return
+	}
+	value = types.Unalias(value)
+	if ptr, ok := value.(*types.Pointer); ok {
+		value = types.Unalias(ptr.Elem())
+	}
+	valueNamed, ok := value.(*types.Named)
+	if !ok {
+		return
+	}
+	from := valueNamed.Origin().Obj()
+	if !tg.isNode(from) {
+		return
+	}
+	to := namedObj(target)
+	if to == nil || to.Pkg() == nil {
+		// Anonymous interfaces and predeclared ones such as error and any.
+		return
+	}
+	if named, ok := to.Type().(*types.Named); ok {
+		to = named.Origin().Obj()
+	}
+	if tg.isHidden(to) {
+		return
+	}
+	if !tg.includeLocalTypes && tg.isLocal(to) {
+		return
+	}
+
+	tg.addReferencedNode(to)
+	fromID := tg.typeID(from)
+	toID := tg.typeID(to)
+	tg.addEdge(fromID, Edge{
+		To:   toID,
+		Kind: UsedAs,
+	})
+	if _, ok := tg.usedAsSites[fromID]; !ok {
+		tg.usedAsSites[fromID] = map[string]([]string){}
+	}
+	file := pos.Filename
+	if rel, err := filepath.Rel(tg.rootDir, file); err == nil {
+		file = rel
+	}
+	tg.usedAsSites[fromID][toID] = append(tg.usedAsSites[fromID][toID],
+		fmt.Sprintf("%s:%d:%d", file, pos.Line, pos.Column))
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/callgraph/vta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// buildCallsEdge builds the call graph of pkgs and collapses it onto the nodes.
+// The call graph is built by VTA on top of CHA.
+func (tg *TypeGraph) buildCallsEdge(pkgs []*packages.Package) {
+	prog, _ := ssautil.Packages(pkgs, ssa.InstantiateGenerics)
+	prog.Build()
+
+	cg := vta.CallGraph(ssautil.AllFunctions(prog), cha.CallGraph(prog))
+	cg.DeleteSyntheticNodes()
+
+	err := callgraph.GraphVisitEdges(cg, func(e *callgraph.Edge) error {
+		caller := tg.callNode(e.Caller.Func)
+		callee := tg.callNode(e.Callee.Func)
+		if caller == nil || callee == nil || caller == callee {
+			return nil
+		}
+		tg.addToEdges(tg.typeID(caller), tg.typeID(callee), Calls)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// callNode returns the node onto which f is collapsed.
+// It is the receiver type for methods, and the function itself for
+// package-level functions if they are included in the nodes.
+// When there is no such node, return nil.
+func (tg *TypeGraph) callNode(f *ssa.Function) types.Object {
+	// Closures belong to the enclosing function.
+	for f.Parent() != nil {
+		f = f.Parent()
+	}
+	if f.Origin() != nil {
+		f = f.Origin()
+	}
+
+	if recv := f.Signature.Recv(); recv != nil {
+		t := recv.Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		named, ok := t.(*types.Named)
+		if !ok {
+			return nil
+		}
+		obj := named.Obj()
+		// The calls inside the external packages are out of interest.
+		if !tg.isNode(obj) || tg.isReferencedNode(obj) {
+			return nil
+		}
+		return obj
+	}
+
+	obj := f.Object()
+	if obj == nil || !tg.isNode(obj) || tg.isReferencedNode(obj) {
+		return nil
+	}
+	return obj
+}
+
+// isNode returns true if obj is added to the node list.
+func (tg *TypeGraph) isNode(obj types.Object) bool {
+	if obj.Pkg() == nil {
+		return false
+	}
+	obj = tg.canonicalObj(obj)
+	for _, pkgToNodes := range []map[string](map[string]types.Object){
+		tg.pkgToStructs, tg.pkgToInterfaces, tg.pkgToOthers, tg.pkgToFuncs, tg.pkgToVars,
+	} {
+		if pkgToNodes[obj.Pkg().Path()][tg.nodeName(obj)] == obj {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package graph
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// isErrorRef returns true if the error view is enabled and obj is
+// the predeclared error interface, which is not ignored in the view.
+func (tg *TypeGraph) isErrorRef(obj types.Object) bool {
+	return tg.errorView && obj == types.Universe.Lookup("error")
+}
+
+// markErrorTypes records the internal types implementing error,
+// and the predeclared error itself.
+func (tg *TypeGraph) markErrorTypes() {
+	errorIface := errorType.Underlying().(*types.Interface)
+	tg.errorNodes["error"] = struct{}{}
+	tg.addReferencedNode(types.Universe.Lookup("error"))
+	for _, pkgToNodes := range []map[string](map[string]types.Object){
+		tg.pkgToStructs, tg.pkgToInterfaces, tg.pkgToOthers,
+	} {
+		for _, nodes := range pkgToNodes {
+			for _, t := range nodes {
+				if tg.isReferencedNode(t) {
+					continue
+				}
+				if implements, _ := implementsInterface(t.Type(), errorIface); implements {
+					tg.errorNodes[tg.typeID(t)] = struct{}{}
+				}
+			}
+		}
+	}
+}
+
+// buildWrapsEdge builds Wraps edges from the error types to the errors
+// held in their fields. (e.g. cause error)
+func (tg *TypeGraph) buildWrapsEdge() {
+	errorIface := errorType.Underlying().(*types.Interface)
+	for _, nodes := range tg.pkgToStructs {
+		for _, t := range nodes {
+			if _, ok := tg.errorNodes[tg.typeID(t)]; !ok {
+				continue
+			}
+			st := t.Type().Underlying().(*types.Struct)
+			for i := 0; i < st.NumFields(); i++ {
+				field := st.Field(i)
+				fieldType := field.Type()
+				if ptr, ok := fieldType.(*types.Pointer); ok {
+					fieldType = ptr.Elem()
+				}
+				if implements, _ := implementsInterface(fieldType, errorIface); !implements {
+					continue
+				}
+				obj := namedObj(fieldType)
+				if obj == nil {
+					continue
+				}
+				if named, ok := obj.Type().(*types.Named); ok {
+					obj = named.Origin().Obj()
+				}
+				tg.addEdgesToTypes([]typeRef{{obj: obj, fieldPath: field.Name()}}, t, Wraps, "")
+			}
+		}
+	}
+}
+
+// buildReturnsErrorEdge builds ReturnsError edges from the function x (or its
+// receiver type) to the concrete types returned as error in its body.
+func (tg *TypeGraph) buildReturnsErrorEdge(x *ast.FuncDecl, info *types.Info) {
+	if x.Body == nil {
+		return
+	}
+	from := receiverObj(x, info)
+	label := x.Name.Name
+	if from == nil {
+		from = info.ObjectOf(x.Name)
+		label = ""
+	}
+	if from == nil || !tg.isNode(from) {
+		return
+	}
+	sig, ok := info.ObjectOf(x.Name).Type().(*types.Signature)
+	if !ok {
+		return
+	}
+
+	ast.Inspect(x.Body, func(n ast.Node) bool {
+		switch y := n.(type) {
+		case *ast.FuncLit:
+			// Returns in a closure belong to the closure.
+			return false
+		case *ast.ReturnStmt:
+			if sig.Results().Len() != len(y.Results) {
+				return true
+			}
+			for i, result := range y.Results {
+				if !types.Identical(sig.Results().At(i).Type(), errorType) {
+					continue
+				}
+				t := info.TypeOf(result)
+				if t == nil || types.IsInterface(t) {
+					// nil, or an error already in the interface.
+					continue
+				}
+				t = types.Unalias(t)
+				if ptr, ok := t.(*types.Pointer); ok {
+					t = types.Unalias(ptr.Elem())
+				}
+				named, ok := t.(*types.Named)
+				if !ok {
+					continue
+				}
+				tg.addEdgesToTypes([]typeRef{{obj: named.Origin().Obj()}}, from, ReturnsError, label)
+			}
+		}
+		return true
+	})
+}
+
+// ErrorNodes returns the set of the IDs of the types implementing error.
+// It is empty unless the error view is enabled.
+func (tg *TypeGraph) ErrorNodes() map[string]struct{} {
+	ret := map[string]struct{}{}
+	for id := range tg.errorNodes {
+		ret[id] = struct{}{}
+	}
+	return ret
+}
@@ -0,0 +1,135 @@
+package graph
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// buildExternalImplementsEdge builds Implements edges from the loaded types
+// to the external interfaces. They are the interfaces referenced by the loaded
+// types and the ones listed in externalInterfaces.
+func (tg *TypeGraph) buildExternalImplementsEdge(pkgs []*packages.Package) error {
+	interfaces := []types.Object{}
+	for _, obj := range tg.referencedNodes {
+		if types.IsInterface(obj.Type()) {
+			interfaces = append(interfaces, obj)
+		}
+	}
+	for _, name := range tg.externalInterfaces {
+		i, err := tg.resolveExternalInterface(name, pkgs)
+		if err != nil {
+			return err
+		}
+		interfaces = append(interfaces, i)
+	}
+
+	for _, i := range interfaces {
+		if tg.isHidden(i) {
+			continue
+		}
+		tg.buildImplementsEdgeTo(i)
+	}
+	return nil
+}
+
+// resolveExternalInterface finds the interface specified by name.
+// name is a predeclared one (e.g. "error"), or a package and a type name
+// (e.g. "io.Writer", "net/http.Handler"). The package is searched in the
+// packages imported by pkgs first, so that the types in the method
+// signatures are identical to the ones used in pkgs.
+// If not found, the package is loaded separately.
+func (tg *TypeGraph) resolveExternalInterface(name string,
+	pkgs []*packages.Package) (types.Object, error) {
+	var obj types.Object
+	pkgPart, typeName, ok := cutLast(name, ".")
+	if !ok {
+		obj = types.Universe.Lookup(name)
+	} else {
+		pkg, err := tg.findPackage(pkgPart, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		obj = pkg.Scope().Lookup(typeName)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("external interface not found: %s", name)
+	}
+	if _, ok := obj.(*types.TypeName); !ok || !types.IsInterface(obj.Type()) {
+		return nil, fmt.Errorf("not an interface: %s", name)
+	}
+	return obj, nil
+}
+
+// findPackage finds the package whose path or name is pkgName.
+func (tg *TypeGraph) findPackage(pkgName string, pkgs []*packages.Package) (*types.Package, error) {
+	byName := []*types.Package{}
+	seen := map[*types.Package]struct{}{}
+	// The packages of the objects used in pkgs, and the ones imported by them.
+	queue := []*types.Package{}
+	for _, pkg := range pkgs {
+		for _, obj := range pkg.TypesInfo.Uses {
+			queue = append(queue, obj.Pkg())
+		}
+	}
+	for len(queue) != 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur == nil {
+			continue
+		}
+		if _, ok := seen[cur]; ok {
+			continue
+		}
+		seen[cur] = struct{}{}
+		if cur.Path() == pkgName {
+			return cur, nil
+		}
+		if cur.Name() == pkgName {
+			byName = append(byName, cur)
+		}
+		queue = append(queue, cur.Imports()...)
+	}
+	if len(byName) == 1 {
+		return byName[0], nil
+	}
+	if len(byName) > 1 {
+		paths := []string{}
+		for _, pkg := range byName {
+			paths = append(paths, pkg.Path())
+		}
+		sort.Strings(paths)
+		return nil, fmt.Errorf("ambiguous package name %s: %s", pkgName, strings.Join(paths, ", "))
+	}
+
+	// Not imported by any package. Load it separately from the source,
+	// as done for the packages to be analyzed.
+	cfg := &packages.Config{
+		Mode: packages.LoadSyntax | packages.NeedDeps,
+		Dir:  tg.rootDir,
+	}
+	if tg.platform != "" {
+		goos, goarch, _ := strings.Cut(tg.platform, "/")
+		cfg.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch)
+	}
+	loaded, err := packages.Load(cfg, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	if len(loaded) != 1 || len(loaded[0].Errors) != 0 || loaded[0].Types == nil {
+		return nil, fmt.Errorf("package not found: %s", pkgName)
+	}
+	return loaded[0].Types, nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -4,8 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/token"
 	"go/types"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"golang.org/x/tools/go/packages"
@@ -15,138 +20,407 @@ type TypeGraph struct {
 	pkgToStructs    map[string](map[string]types.Object)
 	pkgToInterfaces map[string](map[string]types.Object)
 	pkgToOthers     map[string](map[string]types.Object)
+	pkgToFuncs      map[string](map[string]types.Object)
+	pkgToVars       map[string](map[string]types.Object)
 	edges           map[string](map[Edge]struct{})
-	ignoreExternal  bool
-	moduleName      string
+	// funcScopes maps the scope of each function to its name.
+	funcScopes map[*types.Scope]string
+	// localTypes maps each function-local type to the name of the enclosing function.
+	localTypes map[types.Object]string
+	// localNames maps each function-local type to its name unique in the package.
+	// e.g. "ST3.Op1.result", or "ST3.Op1.result@42" for another type with the same
+	//      name declared in another block of the function. (42 is the line number)
+	localNames map[types.Object]string
+	// localNameSet is the set of the IDs given to the function-local types.
+	localNameSet map[string]struct{}
+	// idToPkg maps each node ID to its package path.
+	idToPkg map[string]string
+	// imports maps each package path to the paths of the packages imported by it.
+	imports map[string](map[string]struct{})
+	// usedAsSites maps each UsedAs edge (from and to IDs) to the positions of the conversions.
+	usedAsSites map[string](map[string]([]string))
+	// errorNodes is the set of the IDs of the types implementing error.
+	errorNodes map[string]struct{}
+	// testNodes is the set of the IDs of the nodes declared in the test files.
+	testNodes map[string]struct{}
+	// loadedPkgs is the set of the paths of the loaded packages.
+	loadedPkgs map[string]struct{}
+	// constraintNodes is the set of the IDs of the interfaces synthesized from
+	// the inline constraints. (e.g. ~int | ~string, interface{ Reset() })
+	// They are satisfied by the type arguments, not implemented.
+	constraintNodes map[string]struct{}
+	// predeclaredNodes is the set of the predeclared types which are edge targets.
+	// (e.g. "comparable", "error")
+	predeclaredNodes map[string]struct{}
+	// referencedNodes maps the IDs of the nodes which are referenced by
+	// the loaded packages but declared in the other packages to their objects.
+	referencedNodes map[string]types.Object
+	// pkgScopes maps the path of each loaded package to the scope of its
+	// non-test variant. Used only with the tests.
+	pkgScopes map[string]*types.Scope
+	// nodePlatforms and edgePlatforms map the nodes and the edges found only
+	// on some of the platforms to those platforms. They are set by Merge.
+	nodePlatforms map[string]([]string)
+	edgePlatforms map[string](map[Edge]([]string))
+	// fset is the file set of the loaded packages.
+	fset *token.FileSet
+	// rootDir is the absolute path of the directory given to Build.
+	// The positions are reported relative to it.
+	rootDir           string
+	hideStdlib        bool
+	hideThirdParty    bool
+	externalDepth     int
+	includeFuncs      bool
+	includeLocalTypes bool
+	includeCalls      bool
+	includeVars       bool
+	includeConstructs bool
+	includeAsserts    bool
+	includeUsedAs     bool
+	showPromotion     bool
+	includeTests      bool
+	tags              []string
+	platform          string
+	// externalImplements enables Implements edges toward the external interfaces.
+	externalImplements bool
+	externalInterfaces []string
+	errorView          bool
+	// modules is the paths of the modules regarded as internal.
+	modules []string
+	// pkgModules maps the path of each package in the dependency graph
+	// to its module. The value is nil for the standard library.
+	pkgModules      map[string]*packages.Module
 	packagePatterns []string
 }
 
+// Options is the set of options for building a TypeGraph.
+type Options struct {
+	// HideStdlib ignores the types in the standard library.
+	HideStdlib bool
+	// HideThirdParty ignores the types in the third-party modules.
+	HideThirdParty bool
+	// ExternalDepth keeps the types in the third-party modules only within
+	// ExternalDepth hops from the internal types. 1 keeps the directly referenced
+	// ones, and the larger values follow the types in their definitions.
+	// Negative means no limit.
+	ExternalDepth int
+	// IncludeFuncs adds package-level functions as nodes.
+	IncludeFuncs bool
+	// IncludeLocalTypes adds types declared in function bodies as nodes.
+	IncludeLocalTypes bool
+	// IncludeCalls adds Calls edges built from the call graph.
+	IncludeCalls bool
+	// IncludeVars adds package-level variables and constants as nodes.
+	IncludeVars bool
+	// IncludeConstructs adds Constructs edges found in function bodies.
+	IncludeConstructs bool
+	// IncludeAsserts adds AssertsTo edges for type assertions and type switches.
+	IncludeAsserts bool
+	// IncludeUsedAs adds UsedAs edges for the implicit conversions to interfaces.
+	IncludeUsedAs bool
+	// ShowPromotion marks Implements edges which rely on the methods
+	// promoted from embedded fields.
+	ShowPromotion bool
+	// IncludeTests loads the test files and the external test packages.
+	IncludeTests bool
+	// Tags is the build tags used to load the packages.
+	Tags []string
+	// Platform is the target platform in the GOOS/GOARCH form. (e.g. "linux/amd64")
+	// If empty, the host platform is used.
+	Platform string
+	// ExternalImplements builds Implements edges from the internal types
+	// to the external interfaces referenced by them.
+	ExternalImplements bool
+	// ExternalInterfaces is the additional external interfaces checked
+	// with ExternalImplements. (e.g. "io.Writer", "error", "net/http.Handler")
+	ExternalInterfaces []string
+	// ErrorView marks the types implementing error, and adds Wraps and
+	// ReturnsError edges.
+	ErrorView       bool
+	PackagePatterns []string
+}
+
 type EdgeKind int
 
+func (k EdgeKind) String() string {
+	switch k {
+	case Has:
+		return "Has"
+	case Implements:
+		return "Implements"
+	case Embeds:
+		return "Embeds"
+	case DefinedFrom:
+		return "DefinedFrom"
+	case Accepts:
+		return "Accepts"
+	case Returns:
+		return "Returns"
+	case Instantiates:
+		return "Instantiates"
+	case ConstrainedBy:
+		return "ConstrainedBy"
+	case AliasOf:
+		return "AliasOf"
+	case Calls:
+		return "Calls"
+	case Declares:
+		return "Declares"
+	case Constructs:
+		return "Constructs"
+	case AssertsTo:
+		return "AssertsTo"
+	case UsedAs:
+		return "UsedAs"
+	case Wraps:
+		return "Wraps"
+	case ReturnsError:
+		return "ReturnsError"
+	default:
+		return fmt.Sprintf("EdgeKind(%d)", int(k))
+	}
+}
+
 const (
 	Has EdgeKind = iota
 	Implements
 	Embeds
-	UsesAsAlias
+	DefinedFrom
+	Accepts
+	Returns
+	Instantiates
+	ConstrainedBy
+	AliasOf
+	Calls
+	Declares
+	Constructs
+	AssertsTo
+	UsedAs
+	Wraps
+	ReturnsError
+)
+
+// Multiplicity is the number of the instances of the target type
+// held by the source type, decided by the container of the field.
+type Multiplicity int
+
+const (
+	// e.g. st4 ST4
+	One Multiplicity = iota
+	// e.g. st4 *ST4
+	ZeroOrOne
+	// e.g. st4 []ST4, st4 [2]ST4, st4 ...ST4
+	ZeroOrMore
+	// e.g. st4 map[string]ST4
+	KeyedZeroOrMore
+	// e.g. st4 chan ST4
+	Channel
 )
 
 type Edge struct {
 	To   string
 	Kind EdgeKind
+	// Label is an additional description of the edge.
+	// e.g. The method name for Accepts and Returns edges.
+	//      The instantiated type for Instantiates edges.
+	//      The type parameter name for ConstrainedBy edges.
+	//      The promoted methods for Implements edges.
+	Label string
+	// Field is the path to the field through which the edge is found.
+	// e.g. "st4", or "cfg.store" for a field in an anonymous struct.
+	Field        string
+	Multiplicity Multiplicity
+	// PointerOnly is true if only the pointer type satisfies the interface.
+	// Used for Implements edges.
+	PointerOnly bool
+	// Asserted is true if the implementation is asserted at compile time
+	// (e.g. var _ IF1 = (*ST3)(nil)). Otherwise, it is incidental.
+	// Used for Implements edges.
+	Asserted bool
+	// Via is the embedded fields through which the methods required by
+	// the interface are promoted. (e.g. "ST1")
+	// Used for Implements edges. The promoted methods are in Label.
+	Via string
 }
 
-type importInfo struct {
-	alias string
-	path  string
+// typeRef is a reference to a type found in a type expression.
+type typeRef struct {
+	obj types.Object
+	// typeArgs is the type argument list (e.g. "[int, string]")
+	// if the reference is an instantiation of a generic type.
+	typeArgs string
+	// fieldPath is the path to the field where the reference is found.
+	// (e.g. "st4", "cfg.store")
+	fieldPath    string
+	multiplicity Multiplicity
+	// sigKind is Accepts or Returns if the reference is found in the parameters
+	// or the results of a function type (e.g. f func(ST1) error), and Has otherwise.
+	// A field of a function type does not hold the types in its signature.
+	sigKind EdgeKind
 }
 
-func NewTypeGraph(ignoreExternal bool, moduleName string, pp []string) *TypeGraph {
+func NewTypeGraph(opts Options) *TypeGraph {
 	return &TypeGraph{
-		pkgToStructs:    map[string](map[string]types.Object){},
-		pkgToInterfaces: map[string](map[string]types.Object){},
-		pkgToOthers:     map[string](map[string]types.Object){},
-		edges:           map[string](map[Edge]struct{}){},
-		ignoreExternal:  ignoreExternal,
-		moduleName:      moduleName,
-		packagePatterns: pp,
+		pkgToStructs:       map[string](map[string]types.Object){},
+		pkgToInterfaces:    map[string](map[string]types.Object){},
+		pkgToOthers:        map[string](map[string]types.Object){},
+		pkgToFuncs:         map[string](map[string]types.Object){},
+		pkgToVars:          map[string](map[string]types.Object){},
+		edges:              map[string](map[Edge]struct{}){},
+		funcScopes:         map[*types.Scope]string{},
+		localTypes:         map[types.Object]string{},
+		localNames:         map[types.Object]string{},
+		localNameSet:       map[string]struct{}{},
+		idToPkg:            map[string]string{},
+		imports:            map[string](map[string]struct{}){},
+		usedAsSites:        map[string](map[string]([]string)){},
+		testNodes:          map[string]struct{}{},
+		pkgScopes:          map[string]*types.Scope{},
+		loadedPkgs:         map[string]struct{}{},
+		referencedNodes:    map[string]types.Object{},
+		constraintNodes:    map[string]struct{}{},
+		predeclaredNodes:   map[string]struct{}{},
+		pkgModules:         map[string]*packages.Module{},
+		errorNodes:         map[string]struct{}{},
+		hideStdlib:         opts.HideStdlib,
+		hideThirdParty:     opts.HideThirdParty,
+		externalDepth:      opts.ExternalDepth,
+		includeFuncs:       opts.IncludeFuncs,
+		includeLocalTypes:  opts.IncludeLocalTypes,
+		includeCalls:       opts.IncludeCalls,
+		includeVars:        opts.IncludeVars,
+		includeConstructs:  opts.IncludeConstructs,
+		includeAsserts:     opts.IncludeAsserts,
+		includeUsedAs:      opts.IncludeUsedAs,
+		showPromotion:      opts.ShowPromotion,
+		includeTests:       opts.IncludeTests,
+		tags:               opts.Tags,
+		platform:           opts.Platform,
+		externalImplements: opts.ExternalImplements,
+		externalInterfaces: opts.ExternalInterfaces,
+		errorView:          opts.ErrorView,
+		packagePatterns:    opts.PackagePatterns,
+	}
+}
+
+// typeID returns the canonical ID of obj.
+// e.g. "github.com/peng225/silkroad/internal/graph.TypeGraph"
+//
+//	"github.com/peng225/silkroad/internal/graph.NewTypeGraph.result" for a function-local type
+func (tg *TypeGraph) typeID(obj types.Object) string {
+	if obj.Pkg() == nil {
+		// Predeclared types such as error and comparable.
+		return obj.Name()
 	}
+	id := obj.Pkg().Path() + "." + tg.nodeName(obj)
+	tg.idToPkg[id] = obj.Pkg().Path()
+	return id
 }
 
-func (tg *TypeGraph) findTypeStringsFromExpr(expr ast.Expr, info *types.Info, tps map[string]struct{}) []string {
-	ret := []string{}
+// nodeName returns the name of obj unique in its package.
+func (tg *TypeGraph) nodeName(obj types.Object) string {
+	if name, ok := tg.localNames[obj]; ok {
+		return name
+	}
+	return obj.Name()
+}
+
+// registerLocalType records the enclosing function of obj if obj is a function-local type.
+// When obj is a function-local type, return true.
+func (tg *TypeGraph) registerLocalType(obj types.Object) bool {
+	if obj.Parent() == nil || obj.Parent() == obj.Pkg().Scope() {
+		return false
+	}
+	for s := obj.Parent(); s != nil; s = s.Parent() {
+		if f, ok := tg.funcScopes[s]; ok {
+			tg.localTypes[obj] = f
+			name := f + "." + obj.Name()
+			if _, ok := tg.localNameSet[obj.Pkg().Path()+"."+name]; ok {
+				// Declared in another block of the same function.
+				name = fmt.Sprintf("%s@%d", name, tg.fset.Position(obj.Pos()).Line)
+			}
+			tg.localNames[obj] = name
+			tg.localNameSet[obj.Pkg().Path()+"."+name] = struct{}{}
+			return true
+		}
+	}
+	return false
+}
+
+func (tg *TypeGraph) isLocal(obj types.Object) bool {
+	_, ok := tg.localTypes[obj]
+	return ok
+}
+
+func (tg *TypeGraph) findTypeRefsFromExpr(expr ast.Expr, info *types.Info) []typeRef {
+	ret := []typeRef{}
 
 	switch v := expr.(type) {
 	case *ast.Ident:
-		obj := info.ObjectOf(v)
-		if obj == nil {
-			slog.Error("Obj is nil.", "name", v.Name)
-			return nil
-		}
-		t := obj.Type()
-		switch ut := t.Underlying().(type) {
-		case *types.Struct:
-			ret = append(ret, types.ExprString(expr))
-		case *types.Interface:
-			if _, ok := tps[types.ExprString(expr)]; ok {
-				return nil
-			}
-			ret = append(ret, types.ExprString(expr))
-		case *types.Basic:
-			// Aliased?
-			// Examples of non-aliased type: int, uint8, string
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
-			}
-		case *types.Map:
-			// Aliased?
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
-			}
-		case *types.Slice:
-			// Aliased?
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
-			}
-		case *types.Array:
-			// Aliased?
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
-			}
-		case *types.Pointer:
-			// Aliased?
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
-			}
-		case *types.Chan:
-			// Aliased?
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
-			}
-		case *types.Signature:
-			// Aliased?
-			if t.String() != ut.String() {
-				ret = append(ret, types.ExprString(expr))
+		ret = append(ret, findTypeRefFromIdent(v, info)...)
+	case *ast.SelectorExpr:
+		// e.g. t2.ST200
+		ret = append(ret, findTypeRefFromIdent(v.Sel, info)...)
+	case *ast.StarExpr:
+		for _, ref := range tg.findTypeRefsFromExpr(v.X, info) {
+			if ref.multiplicity == One {
+				ref.multiplicity = ZeroOrOne
 			}
-		default:
-			slog.Warn("ut did not match any types.", "ut", ut.String(),
-				"t", t.String(),
-				"type", fmt.Sprintf("%T", ut))
+			ret = append(ret, ref)
 		}
-	case *ast.StarExpr:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.X, info, tps)...)
 	case *ast.ArrayType:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.Elt, info, tps)...)
+		refs := tg.findTypeRefsFromExpr(v.Elt, info)
+		ret = append(ret, withMultiplicity(refs, ZeroOrMore)...)
 	case *ast.MapType:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.Key, info, tps)...)
-		ret = append(ret, tg.findTypeStringsFromExpr(v.Value, info, tps)...)
-	case *ast.SelectorExpr:
-		ret = append(ret, types.ExprString(v))
+		refs := tg.findTypeRefsFromExpr(v.Key, info)
+		refs = append(refs, tg.findTypeRefsFromExpr(v.Value, info)...)
+		ret = append(ret, withMultiplicity(refs, KeyedZeroOrMore)...)
 	case *ast.ChanType:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.Value, info, tps)...)
+		refs := tg.findTypeRefsFromExpr(v.Value, info)
+		ret = append(ret, withMultiplicity(refs, Channel)...)
 	case *ast.FuncType:
 		if v.Params != nil {
 			for _, param := range v.Params.List {
-				ret = append(ret, tg.findTypeStringsFromExpr(param.Type, info, tps)...)
+				refs := tg.findTypeRefsFromExpr(param.Type, info)
+				ret = append(ret, withSigKind(refs, Accepts)...)
 			}
 		}
 		if v.Results != nil {
-			for _, param := range v.Results.List {
-				ret = append(ret, tg.findTypeStringsFromExpr(param.Type, info, tps)...)
+			for _, result := range v.Results.List {
+				refs := tg.findTypeRefsFromExpr(result.Type, info)
+				ret = append(ret, withSigKind(refs, Returns)...)
 			}
 		}
 	case *ast.IndexExpr:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.Index, info, tps)...)
-		ret = append(ret, tg.findTypeStringsFromExpr(v.X, info, tps)...)
+		// The type arguments are not referenced by the parent directly.
+		// They are kept in the label of the Instantiates edge.
+		ret = append(ret, tg.findGenericTypeRef(v.X, []ast.Expr{v.Index}, info)...)
+	case *ast.IndexListExpr:
+		ret = append(ret, tg.findGenericTypeRef(v.X, v.Indices, info)...)
+	case *ast.UnaryExpr:
+		// e.g. ~int
+		ret = append(ret, tg.findTypeRefsFromExpr(v.X, info)...)
+	case *ast.BinaryExpr:
+		// e.g. ~int | ~string
+		ret = append(ret, tg.findTypeRefsFromExpr(v.X, info)...)
+		ret = append(ret, tg.findTypeRefsFromExpr(v.Y, info)...)
 	case *ast.Ellipsis:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.Elt, info, tps)...)
+		refs := tg.findTypeRefsFromExpr(v.Elt, info)
+		ret = append(ret, withMultiplicity(refs, ZeroOrMore)...)
 	case *ast.ParenExpr:
-		ret = append(ret, tg.findTypeStringsFromExpr(v.X, info, tps)...)
+		ret = append(ret, tg.findTypeRefsFromExpr(v.X, info)...)
 	case *ast.StructType:
-		// Ignore.
-		// e.g. struct{}
+		// e.g. struct{ store *Store }
+		for _, field := range v.Fields.List {
+			refs := tg.findTypeRefsFromExpr(field.Type, info)
+			ret = append(ret, nestInField(refs, field)...)
+		}
 	case *ast.InterfaceType:
-		// Ignore.
-		// e.g. interface{}
+		// e.g. interface{ Get() Store }
+		for _, method := range v.Methods.List {
+			refs := tg.findTypeRefsFromExpr(method.Type, info)
+			ret = append(ret, nestInField(refs, method)...)
+		}
 	default:
 		slog.Warn("expr did not match any types.", "expr", types.ExprString(expr),
 			"type", fmt.Sprintf("%T", v))
@@ -154,203 +428,759 @@ func (tg *TypeGraph) findTypeStringsFromExpr(expr ast.Expr, info *types.Info, tp
 	return ret
 }
 
+// findTypeRefsFromType is the same as findTypeRefsFromExpr
+// except that it finds the refs from the type t instead of the syntax.
+func findTypeRefsFromType(t types.Type) []typeRef {
+	ret := []typeRef{}
+
+	switch v := t.(type) {
+	case *types.Named:
+		ref := typeRef{obj: v.Obj()}
+		if v.TypeArgs().Len() != 0 {
+			typeArgs := []string{}
+			for i := 0; i < v.TypeArgs().Len(); i++ {
+				arg := v.TypeArgs().At(i)
+				typeArgs = append(typeArgs, types.TypeString(arg, shortQualifier(v.Obj().Pkg())))
+			}
+			ref.typeArgs = "[" + strings.Join(typeArgs, ", ") + "]"
+		}
+		ret = append(ret, ref)
+	case *types.Alias:
+		ret = append(ret, typeRef{obj: v.Obj()})
+	case *types.Pointer:
+		for _, ref := range findTypeRefsFromType(v.Elem()) {
+			if ref.multiplicity == One {
+				ref.multiplicity = ZeroOrOne
+			}
+			ret = append(ret, ref)
+		}
+	case *types.Slice:
+		ret = append(ret, withMultiplicity(findTypeRefsFromType(v.Elem()), ZeroOrMore)...)
+	case *types.Array:
+		ret = append(ret, withMultiplicity(findTypeRefsFromType(v.Elem()), ZeroOrMore)...)
+	case *types.Map:
+		refs := findTypeRefsFromType(v.Key())
+		refs = append(refs, findTypeRefsFromType(v.Elem())...)
+		ret = append(ret, withMultiplicity(refs, KeyedZeroOrMore)...)
+	case *types.Chan:
+		ret = append(ret, withMultiplicity(findTypeRefsFromType(v.Elem()), Channel)...)
+	case *types.Signature:
+		for i := 0; i < v.Params().Len(); i++ {
+			ret = append(ret, withSigKind(findTypeRefsFromType(v.Params().At(i).Type()), Accepts)...)
+		}
+		for i := 0; i < v.Results().Len(); i++ {
+			ret = append(ret, withSigKind(findTypeRefsFromType(v.Results().At(i).Type()), Returns)...)
+		}
+	case *types.Struct:
+		for i := 0; i < v.NumFields(); i++ {
+			for _, ref := range findTypeRefsFromType(v.Field(i).Type()) {
+				if ref.fieldPath == "" {
+					ref.fieldPath = v.Field(i).Name()
+				} else {
+					ref.fieldPath = v.Field(i).Name() + "." + ref.fieldPath
+				}
+				ret = append(ret, ref)
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < v.NumEmbeddeds(); i++ {
+			ret = append(ret, findTypeRefsFromType(v.EmbeddedType(i))...)
+		}
+		for i := 0; i < v.NumExplicitMethods(); i++ {
+			for _, ref := range findTypeRefsFromType(v.ExplicitMethod(i).Type()) {
+				ref.fieldPath = v.ExplicitMethod(i).Name()
+				ret = append(ret, ref)
+			}
+		}
+	case *types.Basic, *types.TypeParam, *types.Tuple, *types.Union:
+		// Ignore.
+	default:
+		slog.Warn("t did not match any types.", "t", t.String(),
+			"type", fmt.Sprintf("%T", t))
+	}
+	return ret
+}
+
+// shortQualifier qualifies the types in the other packages than pkg with the package name.
+// e.g. "t11.ST3"
+func shortQualifier(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+}
+
+func findTypeRefFromIdent(ident *ast.Ident, info *types.Info) []typeRef {
+	// Use Uses instead of ObjectOf because ObjectOf returns the field
+	// rather than the type for embedded fields.
+	obj := info.Uses[ident]
+	if obj == nil {
+		slog.Error("Obj is nil.", "name", ident.Name)
+		return nil
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		slog.Warn("obj is not a type name.", "name", ident.Name,
+			"type", fmt.Sprintf("%T", obj))
+		return nil
+	}
+	if _, ok := obj.Type().(*types.TypeParam); ok {
+		return nil
+	}
+	return []typeRef{{obj: obj}}
+}
+
+// withMultiplicity overwrites the multiplicity of refs with m
+// because the outermost container determines the multiplicity.
+func withMultiplicity(refs []typeRef, m Multiplicity) []typeRef {
+	for i := range refs {
+		refs[i].multiplicity = m
+	}
+	return refs
+}
+
+// withSigKind marks refs as found in the parameters or the results of a function type.
+func withSigKind(refs []typeRef, kind EdgeKind) []typeRef {
+	for i := range refs {
+		refs[i].sigKind = kind
+	}
+	return refs
+}
+
+// nestInField returns refs found in field of an anonymous struct or interface literal
+// with the field name prepended to their field paths.
+func nestInField(refs []typeRef, field *ast.Field) []typeRef {
+	names := []string{}
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	if len(names) == 0 {
+		names = append(names, embeddedFieldName(field.Type))
+	}
+
+	ret := []typeRef{}
+	for _, name := range names {
+		for _, ref := range refs {
+			if ref.fieldPath == "" {
+				ref.fieldPath = name
+			} else {
+				ref.fieldPath = name + "." + ref.fieldPath
+			}
+			ret = append(ret, ref)
+		}
+	}
+	return ret
+}
+
+// embeddedFieldName returns the field name of the embedded field
+// whose type is expr. (e.g. "Reader" for *io.Reader)
+func embeddedFieldName(expr ast.Expr) string {
+	switch v := expr.(type) {
+	case *ast.Ident:
+		return v.Name
+	case *ast.SelectorExpr:
+		return v.Sel.Name
+	case *ast.StarExpr:
+		return embeddedFieldName(v.X)
+	case *ast.IndexExpr:
+		return embeddedFieldName(v.X)
+	case *ast.IndexListExpr:
+		return embeddedFieldName(v.X)
+	}
+	return types.ExprString(expr)
+}
+
+// findGenericTypeRef returns the reference to the generic type x
+// instantiated with indices.
+func (tg *TypeGraph) findGenericTypeRef(x ast.Expr, indices []ast.Expr,
+	info *types.Info) []typeRef {
+	typeArgs := []string{}
+	for _, index := range indices {
+		typeArgs = append(typeArgs, types.ExprString(index))
+	}
+	ret := tg.findTypeRefsFromExpr(x, info)
+	for i := range ret {
+		ret[i].typeArgs = "[" + strings.Join(typeArgs, ", ") + "]"
+	}
+	return ret
+}
+
 func (tg *TypeGraph) addToEdges(from, to string, kind EdgeKind) {
+	tg.addToEdgesWithLabel(from, to, kind, "")
+}
+
+func (tg *TypeGraph) addToEdgesWithLabel(from, to string, kind EdgeKind, label string) {
+	tg.addEdge(from, Edge{
+		To:    to,
+		Kind:  kind,
+		Label: label,
+	})
+}
+
+func (tg *TypeGraph) addEdge(from string, edge Edge) {
 	if _, ok := tg.edges[from]; !ok {
 		tg.edges[from] = map[Edge]struct{}{}
 	}
-	tg.edges[from][Edge{
-		To:   to,
-		Kind: kind,
-	}] = struct{}{}
+	tg.edges[from][edge] = struct{}{}
 }
 
-func containedInBlacklist(name string) bool {
-	return name == "any" || name == "error" || name == "comparable"
+// isHidden returns true if obj is declared in a package of the hidden class.
+func (tg *TypeGraph) isHidden(obj types.Object) bool {
+	return obj.Pkg() != nil && tg.isHiddenPath(obj.Pkg().Path())
 }
 
-func (tg *TypeGraph) findFullTypeName(name string, parent types.Object, ii []importInfo) string {
-	fullName := parent.Pkg().Path() + "." + name
-	for _, v := range ii {
-		tokens := strings.Split(name, ".")
-		if len(tokens) == 2 {
-			if v.alias == tokens[0] || strings.HasSuffix(v.path, tokens[0]) {
-				fullName = v.path + "." + tokens[1]
-				break
-			}
+func (tg *TypeGraph) isHiddenPath(pkgPath string) bool {
+	switch tg.ClassOf(pkgPath) {
+	case Stdlib:
+		return tg.hideStdlib
+	case ThirdParty:
+		return tg.hideThirdParty
+	}
+	return false
+}
+
+func (tg *TypeGraph) addEdgesToTypes(refs []typeRef, parent types.Object,
+	kind EdgeKind, label string) {
+	for _, ref := range refs {
+		// Ignore predeclared types such as int, any and error.
+		// The error view keeps error in the fields.
+		if ref.obj.Pkg() == nil &&
+			!(tg.isErrorRef(ref.obj) && (kind == Has || kind == Embeds || kind == Wraps)) {
+			continue
+		}
+		if tg.isHidden(ref.obj) {
+			continue
+		}
+		if !tg.includeLocalTypes && tg.isLocal(ref.obj) {
+			continue
+		}
+		tg.addReferencedNode(ref.obj)
+		edge := Edge{
+			To:           tg.typeID(ref.obj),
+			Kind:         kind,
+			Label:        label,
+			Field:        ref.fieldPath,
+			Multiplicity: ref.multiplicity,
+		}
+		if kind == Has && ref.sigKind != Has {
+			// e.g. f func(ST1) is a field which accepts ST1, not a field holding ST1.
+			edge.Kind = ref.sigKind
+		}
+		tg.addEdge(tg.typeID(parent), edge)
+		if ref.typeArgs != "" {
+			// The instantiation is an edge of its own so that the original kind
+			// (e.g. Embeds for struct{ Base[int] }) is kept.
+			tg.addToEdgesWithLabel(tg.typeID(parent), tg.typeID(ref.obj),
+				Instantiates, ref.obj.Name()+ref.typeArgs)
 		}
 	}
-	return fullName
 }
 
-func (tg *TypeGraph) buildHasEdge(fields []*ast.Field, info *types.Info, parent types.Object,
-	ii []importInfo, tps map[string]struct{}) {
-	for _, field := range fields {
-		typeNames := tg.findTypeStringsFromExpr(field.Type, info, tps)
-		embedded := field.Names == nil
-		kind := Has
-		if embedded {
-			kind = Embeds
+// buildConstraintEdge builds edges from parent to the constraints of its type parameters.
+// A constraint written inline (e.g. ~int | ~string, interface{ Reset() })
+// is added to the node list.
+func (tg *TypeGraph) buildConstraintEdge(typeParams *ast.FieldList, info *types.Info,
+	parent types.Object) {
+	if typeParams == nil {
+		return
+	}
+	for _, field := range typeParams.List {
+		names := []string{}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
 		}
-		for _, name := range typeNames {
-			if containedInBlacklist(name) {
+		label := strings.Join(names, ", ")
+
+		switch c := field.Type.(type) {
+		case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr, *ast.IndexListExpr:
+			refs := tg.findTypeRefsFromExpr(c, info)
+			for i := range refs {
+				if refs[i].obj == types.Universe.Lookup("comparable") {
+					if !tg.hideStdlib {
+						tg.addReferencedNode(refs[i].obj)
+						tg.addToEdgesWithLabel(tg.typeID(parent), tg.typeID(refs[i].obj),
+							ConstrainedBy, label)
+					}
+					continue
+				}
+				// The constraint itself is not an instantiation from the viewpoint of parent.
+				refs[i].typeArgs = ""
+			}
+			tg.addEdgesToTypes(refs, parent, ConstrainedBy, label)
+		default:
+			if len(field.Names) == 0 {
 				continue
 			}
-			fullName := tg.findFullTypeName(name, parent, ii)
-			if tg.ignoreExternal && !strings.HasPrefix(fullName, tg.moduleName) {
+			tp, ok := info.ObjectOf(field.Names[0]).Type().(*types.TypeParam)
+			if !ok {
 				continue
 			}
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(), fullName, kind)
+			typeSet := types.NewTypeName(c.Pos(), parent.Pkg(), types.ExprString(c), tp.Constraint())
+			tg.addToNodesHelper(tg.pkgToInterfaces, typeSet)
+			tg.constraintNodes[tg.typeID(typeSet)] = struct{}{}
+			tg.addToEdgesWithLabel(tg.typeID(parent), tg.typeID(typeSet), ConstrainedBy, label)
+			tg.addEdgesToTypes(tg.findTypeRefsFromExpr(c, info), typeSet, Embeds, "")
 		}
 	}
 }
 
-func (tg *TypeGraph) buildImplementsEdge() {
-	for ipkg, interfaces := range tg.pkgToInterfaces {
-		for _, i := range interfaces {
-			typedI, ok := i.Type().Underlying().(*types.Interface)
-			if !ok {
-				panic("should be interface type")
-			}
-			for spkg, structs := range tg.pkgToStructs {
-				for _, s := range structs {
-					ptr := types.NewPointer(s.Type())
-					if types.Implements(ptr, typedI) && !typedI.Empty() {
-						tg.addToEdges(spkg+"."+s.Name(), ipkg+"."+i.Name(), Implements)
-					}
-				}
-			}
+func (tg *TypeGraph) buildHasEdge(fields []*ast.Field, info *types.Info, parent types.Object) {
+	for _, field := range fields {
+		refs := tg.findTypeRefsFromExpr(field.Type, info)
+		embedded := field.Names == nil
+		if embedded {
+			tg.addEdgesToTypes(withMultiplicity(refs, One), parent, Embeds, "")
+			continue
 		}
+		tg.addEdgesToTypes(nestInField(refs, field), parent, Has, "")
 	}
 }
 
-func (tg *TypeGraph) buildEdge(x *ast.TypeSpec, info *types.Info,
-	parent types.Object, ii []importInfo) {
-	// Get a type parameter list
-	tps := map[string]struct{}{}
-	if x.TypeParams != nil {
-		for _, tp := range x.TypeParams.List {
-			for _, name := range tp.Names {
-				tps[name.Name] = struct{}{}
-			}
+func (tg *TypeGraph) buildMethodEdge(methodName string, ft *ast.FuncType, info *types.Info,
+	parent types.Object) {
+	if ft.Params != nil {
+		for _, param := range ft.Params.List {
+			refs := tg.findTypeRefsFromExpr(param.Type, info)
+			tg.addEdgesToTypes(refs, parent, Accepts, methodName)
+		}
+	}
+	if ft.Results != nil {
+		for _, result := range ft.Results.List {
+			refs := tg.findTypeRefsFromExpr(result.Type, info)
+			tg.addEdgesToTypes(refs, parent, Returns, methodName)
 		}
 	}
+}
 
-	switch t := x.Type.(type) {
-	case *ast.StructType:
-		tg.buildHasEdge(t.Fields.List, info, parent, ii, tps)
-	case *ast.InterfaceType:
-		tg.buildHasEdge(t.Methods.List, info, parent, ii, tps)
-	case *ast.Ident:
-		childObj := info.ObjectOf(t)
-		if childObj == nil {
-			return
-		}
-		if containedInBlacklist(childObj.Name()) {
-			break
-		}
-		switch childObj.Type().Underlying().(type) {
-		case *types.Struct:
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(childObj.Name(), parent, ii),
-				UsesAsAlias)
-		case *types.Interface:
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(childObj.Name(), parent, ii),
-				UsesAsAlias)
-		case *types.Basic:
-			// Ignore.
-		default:
-			slog.Error("Failed to build edge", "type", fmt.Sprintf("%T", t),
-				"childObjType", childObj.Type().Underlying())
+func (tg *TypeGraph) buildInterfaceEdge(methods []*ast.Field, info *types.Info, parent types.Object) {
+	for _, method := range methods {
+		ft, ok := method.Type.(*ast.FuncType)
+		if method.Names == nil || !ok {
+			// Embedded interface.
+			tg.buildHasEdge([]*ast.Field{method}, info, parent)
+			continue
 		}
-	case *ast.MapType:
-		typs := tg.findTypeStringsFromExpr(t.Key, info, tps)
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+		for _, name := range method.Names {
+			tg.buildMethodEdge(name.Name, ft, info, parent)
 		}
-		typs = tg.findTypeStringsFromExpr(t.Value, info, tps)
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+	}
+}
+
+// buildReceiverMethodEdge builds edges from the receiver type of x
+// to the types in the signature of x.
+func (tg *TypeGraph) buildReceiverMethodEdge(x *ast.FuncDecl, info *types.Info) {
+	recv := receiverObj(x, info)
+	if recv == nil {
+		return
+	}
+
+	tg.buildMethodEdge(x.Name.Name, x.Type, info, recv)
+}
+
+// receiverObj returns the receiver type of x.
+// If x is not a method, return nil.
+func receiverObj(x *ast.FuncDecl, info *types.Info) types.Object {
+	if x.Recv == nil {
+		return nil
+	}
+	f, ok := info.ObjectOf(x.Name).(*types.Func)
+	if !ok {
+		return nil
+	}
+	sig, ok := f.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return nil
+	}
+	recvType := sig.Recv().Type()
+	if ptr, ok := recvType.(*types.Pointer); ok {
+		recvType = ptr.Elem()
+	}
+	named, ok := recvType.(*types.Named)
+	if !ok {
+		return nil
+	}
+	return named.Obj()
+}
+
+// registerFuncLitScopes records the scopes of the function literals in the
+// initializers of the package-level variables declared in x, so that the types
+// declared in them are regarded as function-local. They are named after the variables.
+// e.g. var G = func() { type res struct{} } declares "G.res".
+func (tg *TypeGraph) registerFuncLitScopes(x *ast.ValueSpec, info *types.Info) {
+	if len(x.Names) == 0 {
+		return
+	}
+	obj := info.ObjectOf(x.Names[0])
+	if obj == nil || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		// The function literals in a function belong to the function.
+		return
+	}
+	for i, value := range x.Values {
+		name := x.Names[min(i, len(x.Names)-1)].Name
+		ast.Inspect(value, func(n ast.Node) bool {
+			lit, ok := n.(*ast.FuncLit)
+			if !ok {
+				return true
+			}
+			if scope, ok := info.Scopes[lit.Type]; ok {
+				tg.funcScopes[scope] = name
+			}
+			// The nested ones are found through the parent scopes.
+			return false
+		})
+	}
+}
+
+// funcName returns the name of x.
+// For methods, the receiver type name is prepended. (e.g. "ST3.Op1")
+func funcName(x *ast.FuncDecl) string {
+	if x.Recv == nil || len(x.Recv.List) == 0 {
+		return x.Name.Name
+	}
+	return embeddedFieldName(x.Recv.List[0].Type) + "." + x.Name.Name
+}
+
+// buildVarEdge adds the package-level variables and constants declared in x
+// to the node list and builds Declares edges to their types.
+// A blank variable (e.g. var _ IF1 = (*ST3)(nil)) is not a node,
+// but an Implements edge from the type of the value to the declared interface.
+func (tg *TypeGraph) buildVarEdge(x *ast.ValueSpec, info *types.Info) {
+	for i, name := range x.Names {
+		if name.Name == "_" {
+			if x.Type != nil && i < len(x.Values) {
+				tg.buildBlankVarEdge(info.TypeOf(x.Type), info.TypeOf(x.Values[i]))
+			}
+			continue
 		}
-	case *ast.ArrayType:
-		typs := tg.findTypeStringsFromExpr(t.Elt, info, tps)
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+		if !tg.includeVars {
+			continue
 		}
-	case *ast.StarExpr:
-		typs := tg.findTypeStringsFromExpr(t.X, info, tps)
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+		obj := info.ObjectOf(name)
+		if obj == nil || obj.Parent() != obj.Pkg().Scope() {
+			// Not a package-level one.
+			continue
 		}
-	case *ast.ChanType:
-		typs := tg.findTypeStringsFromExpr(t.Value, info, tps)
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+		tg.addToNodesHelper(tg.pkgToVars, obj)
+		if x.Type != nil {
+			tg.addEdgesToTypes(tg.findTypeRefsFromExpr(x.Type, info), obj, Declares, "")
+		} else {
+			tg.addEdgesToTypes(findTypeRefsFromType(obj.Type()), obj, Declares, "")
 		}
-	case *ast.FuncType:
-		typs := []string{}
-		if t.Params != nil {
-			for _, param := range t.Params.List {
-				typs = append(typs, tg.findTypeStringsFromExpr(param.Type, info, tps)...)
+	}
+}
+
+func (tg *TypeGraph) buildBlankVarEdge(declared, value types.Type) {
+	if declared == nil || value == nil {
+		return
+	}
+	iface, ok := declared.Underlying().(*types.Interface)
+	if !ok || iface.Empty() {
+		return
+	}
+	// The edge is attached to the types denoted by the aliases.
+	// e.g. var _ IF1 = AliasForST1{} asserts that ST1 implements IF1.
+	declaredNamed, ok := types.Unalias(declared).(*types.Named)
+	if !ok {
+		return
+	}
+	value = types.Unalias(value)
+	if ptr, ok := value.(*types.Pointer); ok {
+		value = types.Unalias(ptr.Elem())
+	}
+	valueNamed, ok := value.(*types.Named)
+	if !ok {
+		return
+	}
+	to := declaredNamed.Origin().Obj()
+	from := valueNamed.Origin().Obj()
+	if from.Pkg() == nil || to.Pkg() == nil {
+		return
+	}
+	if tg.isHidden(from) || tg.isHidden(to) {
+		return
+	}
+	implements, pointerOnly := implementsInterface(value, iface)
+	if !implements {
+		return
+	}
+	tg.addReferencedNode(from)
+	tg.addReferencedNode(to)
+	edge := Edge{
+		To:          tg.typeID(to),
+		Kind:        Implements,
+		PointerOnly: pointerOnly,
+		Asserted:    true,
+	}
+	if tg.showPromotion {
+		edge.Via, edge.Label = promotedVia(value, iface, pointerOnly)
+	}
+	tg.addEdge(tg.typeID(from), edge)
+}
+
+// isAlias returns true if obj is a type alias. (e.g. type AliasForST1 = ST1)
+func isAlias(obj types.Object) bool {
+	_, ok := obj.Type().(*types.Alias)
+	return ok
+}
+
+// namedObj returns the type name of t if t is a named type or an alias.
+func namedObj(t types.Type) types.Object {
+	switch v := t.(type) {
+	case *types.Named:
+		return v.Obj()
+	case *types.Alias:
+		return v.Obj()
+	}
+	return nil
+}
+
+// buildFuncEdge adds the package-level function x to the node list
+// and builds edges to the types in its signature.
+func (tg *TypeGraph) buildFuncEdge(x *ast.FuncDecl, info *types.Info) {
+	if x.Recv != nil || x.Name.Name == "init" || x.Name.Name == "_" {
+		return
+	}
+	obj := info.ObjectOf(x.Name)
+	if obj == nil {
+		return
+	}
+	tg.addToNodesHelper(tg.pkgToFuncs, obj)
+
+	tg.buildMethodEdge("", x.Type, info, obj)
+	tg.buildConstraintEdge(x.Type.TypeParams, info, obj)
+}
+
+func (tg *TypeGraph) buildImplementsEdge() {
+	for _, interfaces := range tg.pkgToInterfaces {
+		for _, i := range interfaces {
+			if tg.isReferencedNode(i) || tg.isConstraintNode(i) {
+				continue
 			}
+			tg.buildImplementsEdgeTo(i)
 		}
-		if t.Results != nil {
-			for _, param := range t.Results.List {
-				typs = append(typs, tg.findTypeStringsFromExpr(param.Type, info, tps)...)
+	}
+}
+
+// buildImplementsEdgeTo builds Implements edges from the nodes to the interface i.
+func (tg *TypeGraph) buildImplementsEdgeTo(i types.Object) {
+	typedI, ok := i.Type().Underlying().(*types.Interface)
+	if !ok {
+		panic("should be interface type")
+	}
+	// Type sets (e.g. ~int | ~string) are satisfied by types in constraints,
+	// not implemented.
+	if typedI.Empty() || !typedI.IsMethodSet() || isAlias(i) {
+		return
+	}
+	for _, pkgToNodes := range []map[string](map[string]types.Object){
+		tg.pkgToStructs, tg.pkgToInterfaces, tg.pkgToOthers,
+	} {
+		for _, nodes := range pkgToNodes {
+			for _, t := range nodes {
+				if t == i || tg.isReferencedNode(t) || tg.isConstraintNode(t) {
+					continue
+				}
+				if isAlias(t) {
+					// The edges from an alias duplicate the ones from the type it denotes.
+					continue
+				}
+				implements, pointerOnly := tg.implementsNode(t, i)
+				if !implements {
+					continue
+				}
+				if typedT, ok := t.Type().Underlying().(*types.Interface); ok &&
+					types.Implements(i.Type(), typedT) {
+					// Equivalent interfaces implement each other.
+					// The edges are just noise, so ignore them.
+					continue
+				}
+				tg.addReferencedNode(i)
+				edge := Edge{
+					To:          tg.typeID(i),
+					Kind:        Implements,
+					PointerOnly: pointerOnly,
+					Asserted:    true,
+				}
+				if tg.showPromotion {
+					edge.Via, edge.Label = promotedVia(t.Type(), typedI, pointerOnly)
+				}
+				if _, ok := tg.edges[tg.typeID(t)][edge]; ok {
+					// Already found as an asserted one.
+					continue
+				}
+				edge.Asserted = false
+				tg.addEdge(tg.typeID(t), edge)
 			}
 		}
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+	}
+}
+
+// implementsNode reports whether the node t implements the interface node i.
+// The types declared in the test files are checked against the types
+// seen from their packages.
+func (tg *TypeGraph) implementsNode(t, i types.Object) (implements, pointerOnly bool) {
+	if _, ok := tg.testNodes[tg.typeID(t)]; ok {
+		i = inUniverseOf(i, t.Pkg())
+	} else if _, ok := tg.testNodes[tg.typeID(i)]; ok {
+		t = inUniverseOf(t, i.Pkg())
+	}
+	return implementsInterface(t.Type(), i.Type().Underlying().(*types.Interface))
+}
+
+// promotedVia returns the embedded fields through which t gets the methods of i
+// and the names of those promoted methods. (e.g. "ST1", "Op1, Op2")
+// If t implements i by its own methods, both are empty.
+func promotedVia(t types.Type, i *types.Interface, pointerOnly bool) (via, methods string) {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return "", ""
+	}
+	if pointerOnly {
+		t = types.NewPointer(t)
+	}
+	mset := types.NewMethodSet(t)
+	fields := []string{}
+	names := []string{}
+	for k := 0; k < i.NumMethods(); k++ {
+		m := i.Method(k)
+		sel := mset.Lookup(m.Pkg(), m.Name())
+		if sel == nil || len(sel.Index()) < 2 {
+			// Declared by t itself.
+			continue
 		}
-	case *ast.Ellipsis:
-		typs := tg.findTypeStringsFromExpr(t.Elt, info, tps)
-		for _, typ := range typs {
-			tg.addToEdges(parent.Pkg().Path()+"."+parent.Name(),
-				tg.findFullTypeName(typ, parent, ii), UsesAsAlias)
+		field := st.Field(sel.Index()[0]).Name()
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
 		}
+		names = append(names, m.Name())
+	}
+	return strings.Join(fields, ", "), strings.Join(names, ", ")
+}
+
+// implementsInterface reports whether t implements i.
+// If only the pointer type of t implements i, pointerOnly is true.
+func implementsInterface(t types.Type, i *types.Interface) (implements, pointerOnly bool) {
+	if types.Implements(t, i) {
+		return true, false
+	}
+	switch t.Underlying().(type) {
+	case *types.Interface, *types.Pointer:
+		// The method set of a pointer to them is empty.
+		return false, false
+	}
+	if types.Implements(types.NewPointer(t), i) {
+		return true, true
+	}
+	return false, false
+}
+
+func (tg *TypeGraph) buildEdge(x *ast.TypeSpec, info *types.Info, parent types.Object) {
+	tg.buildConstraintEdge(x.TypeParams, info, parent)
+
+	switch t := x.Type.(type) {
+	case *ast.StructType:
+		tg.buildHasEdge(t.Fields.List, info, parent)
+	case *ast.InterfaceType:
+		tg.buildInterfaceEdge(t.Methods.List, info, parent)
 	default:
-		slog.Error("Failed to build edge", "type", fmt.Sprintf("%T", t))
+		kind := DefinedFrom
+		if _, ok := parent.Type().(*types.Alias); ok {
+			// e.g. type A = B
+			kind = AliasOf
+		}
+		refs := tg.findTypeRefsFromExpr(t, info)
+		tg.addEdgesToTypes(refs, parent, kind, "")
 	}
 }
 
-func addToNodesHelper(dest map[string](map[string]types.Object), obj types.Object) {
+func (tg *TypeGraph) addToNodesHelper(dest map[string](map[string]types.Object), obj types.Object) {
 	if dest[obj.Pkg().Path()] == nil {
 		dest[obj.Pkg().Path()] = map[string]types.Object{}
 	}
-	dest[obj.Pkg().Path()][obj.Name()] = obj
+	dest[obj.Pkg().Path()][tg.nodeName(obj)] = obj
+	if tg.isTestObj(obj) {
+		tg.testNodes[tg.typeID(obj)] = struct{}{}
+	}
+}
+
+// isTestObj returns true if obj is declared in a test file
+// or in an external test package.
+func (tg *TypeGraph) isTestObj(obj types.Object) bool {
+	if !tg.includeTests {
+		return false
+	}
+	if strings.HasSuffix(obj.Pkg().Path(), "_test") {
+		return true
+	}
+	return strings.HasSuffix(tg.fset.Position(obj.Pos()).Filename, "_test.go")
+}
+
+// addReferencedNode adds obj to the node list if it is declared in a package
+// which is not loaded, so that the referenced types are drawn with the same
+// shapes as the loaded ones. Such nodes are marked as referenced-only.
+// The predeclared types (e.g. comparable) are recorded separately.
+func (tg *TypeGraph) addReferencedNode(obj types.Object) {
+	if obj.Pkg() == nil {
+		if _, ok := obj.(*types.TypeName); ok {
+			tg.predeclaredNodes[obj.Name()] = struct{}{}
+		}
+		return
+	}
+	if tg.isLoaded(obj.Pkg().Path()) || tg.isReferencedNode(obj) {
+		return
+	}
+	if tg.addToNodes(obj) {
+		tg.referencedNodes[tg.typeID(obj)] = obj
+	}
+}
+
+// isReferencedNode returns true if obj is added to the node list
+// only because it is referenced by the loaded packages.
+func (tg *TypeGraph) isReferencedNode(obj types.Object) bool {
+	if obj.Pkg() == nil {
+		return false
+	}
+	_, ok := tg.referencedNodes[tg.typeID(obj)]
+	return ok
+}
+
+func (tg *TypeGraph) isLoaded(pkgPath string) bool {
+	_, ok := tg.loadedPkgs[pkgPath]
+	return ok
+}
+
+// IsReferencedOnly returns true if the package pkgPath is not loaded
+// and only its types referenced by the loaded packages are in the graph.
+func (tg *TypeGraph) IsReferencedOnly(pkgPath string) bool {
+	return !tg.isLoaded(pkgPath)
 }
 
 // When obj is added to the node list, return true.
 func (tg *TypeGraph) addToNodes(obj types.Object) bool {
 	switch ut := obj.Type().Underlying().(type) {
 	case *types.Struct:
-		addToNodesHelper(tg.pkgToStructs, obj)
+		tg.addToNodesHelper(tg.pkgToStructs, obj)
 	case *types.Interface:
-		addToNodesHelper(tg.pkgToInterfaces, obj)
+		tg.addToNodesHelper(tg.pkgToInterfaces, obj)
 	case *types.Basic:
 		// Basic type and not aliased? (e.g. int, uint8, string)
 		if obj.Type().String() == ut.String() {
 			return false
 		}
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	case *types.Map:
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	case *types.Slice:
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	case *types.Array:
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	case *types.Pointer:
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	case *types.Chan:
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	case *types.Signature:
-		addToNodesHelper(tg.pkgToOthers, obj)
+		tg.addToNodesHelper(tg.pkgToOthers, obj)
 	default:
 		slog.Info("obj was not added to the node list.", "name", obj.Name())
 		return false
@@ -359,10 +1189,115 @@ func (tg *TypeGraph) addToNodes(obj types.Object) bool {
 	return true
 }
 
+func (tg *TypeGraph) addToImports(pkg *packages.Package) {
+	if _, ok := tg.imports[pkg.PkgPath]; !ok {
+		tg.imports[pkg.PkgPath] = map[string]struct{}{}
+	}
+	for _, imp := range pkg.Imports {
+		if tg.isHiddenPath(imp.PkgPath) {
+			continue
+		}
+		tg.imports[pkg.PkgPath][imp.PkgPath] = struct{}{}
+	}
+}
+
+// dropTestMains removes the generated test main packages ("p.test")
+// loaded with the tests.
+func dropTestMains(pkgs []*packages.Package) []*packages.Package {
+	ret := []*packages.Package{}
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+		ret = append(ret, pkg)
+	}
+	return ret
+}
+
+// isTestVariant returns true if pkg is the variant of a package recompiled
+// with its in-package test files. (e.g. "p [p.test]")
+// The other packages import the non-test variant "p", so the types are taken
+// from it, and only the declarations in the test files are taken from pkg.
+func isTestVariant(pkg *packages.Package) bool {
+	return pkg.ID == fmt.Sprintf("%s [%s.test]", pkg.PkgPath, pkg.PkgPath)
+}
+
+// pkgScope returns the package scope of pkg.
+// pkg.Types is not loaded, so the scope is found through the defined objects.
+func pkgScope(pkg *packages.Package) *types.Scope {
+	for _, obj := range pkg.TypesInfo.Defs {
+		if obj != nil && obj.Pkg() != nil {
+			return obj.Pkg().Scope()
+		}
+	}
+	return nil
+}
+
+// canonicalObj returns the object of the non-test variant if obj is declared
+// in the non-test files of a test variant. Otherwise, return obj.
+func (tg *TypeGraph) canonicalObj(obj types.Object) types.Object {
+	if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return obj
+	}
+	scope, ok := tg.pkgScopes[obj.Pkg().Path()]
+	if !ok || scope == obj.Parent() {
+		return obj
+	}
+	if c := scope.Lookup(obj.Name()); c != nil {
+		return c
+	}
+	// Declared in a test file.
+	return obj
+}
+
+// inUniverseOf returns obj as seen from the package pkg.
+// The packages recompiled with the test files have their own objects
+// for the declarations in the non-test files, which are not identical to
+// the ones seen from the other packages.
+func inUniverseOf(obj types.Object, pkg *types.Package) types.Object {
+	if obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return obj
+	}
+	seen := map[*types.Package]struct{}{}
+	queue := []*types.Package{pkg}
+	for len(queue) != 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if _, ok := seen[cur]; ok {
+			continue
+		}
+		seen[cur] = struct{}{}
+		if cur.Path() == obj.Pkg().Path() {
+			if o := cur.Scope().Lookup(obj.Name()); o != nil {
+				return o
+			}
+			return obj
+		}
+		queue = append(queue, cur.Imports()...)
+	}
+	return obj
+}
+
 func (tg *TypeGraph) Build(path string) error {
 	cfg := &packages.Config{
-		Mode: packages.NeedSyntax | packages.NeedTypesInfo,
-		Dir:  path,
+		Mode: packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedImports | packages.NeedName |
+			packages.NeedModule,
+		Dir:   path,
+		Tests: tg.includeTests,
+	}
+	if tg.includeCalls {
+		// Required to build the SSA program.
+		cfg.Mode |= packages.LoadSyntax | packages.NeedDeps
+	}
+	if len(tg.tags) != 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(tg.tags, ",")}
+	}
+	if tg.platform != "" {
+		goos, goarch, ok := strings.Cut(tg.platform, "/")
+		if !ok {
+			return fmt.Errorf("invalid platform: %s", tg.platform)
+		}
+		cfg.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch)
 	}
 	pkgs, err := packages.Load(cfg, tg.packagePatterns...)
 	if err != nil {
@@ -371,31 +1306,70 @@ func (tg *TypeGraph) Build(path string) error {
 	if packages.PrintErrors(pkgs) > 0 {
 		return errors.New("error count is not 0")
 	}
+	tg.rootDir, err = filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if tg.includeTests {
+		pkgs = dropTestMains(pkgs)
+		for _, pkg := range pkgs {
+			if pkg.ID == pkg.PkgPath {
+				tg.pkgScopes[pkg.PkgPath] = pkgScope(pkg)
+			}
+		}
+	}
+	if len(pkgs) != 0 {
+		tg.fset = pkgs[0].Fset
+	}
+	for _, pkg := range pkgs {
+		tg.loadedPkgs[pkg.PkgPath] = struct{}{}
+	}
+	tg.modules, err = findModules(path, pkgs)
+	if err != nil {
+		return err
+	}
+	tg.pkgModules, err = findPkgModules(cfg, tg.packagePatterns)
+	if err != nil {
+		return err
+	}
 
+	bodies := []funcBody{}
 	for _, pkg := range pkgs {
+		tg.addToImports(pkg)
 		for _, syntax := range pkg.Syntax {
-			ii := []importInfo{}
+			if isTestVariant(pkg) &&
+				!strings.HasSuffix(pkg.Fset.Position(syntax.Pos()).Filename, "_test.go") {
+				// Taken from the non-test variant.
+				continue
+			}
 			ast.Inspect(syntax, func(n ast.Node) bool {
 				switch x := n.(type) {
-				case *ast.ImportSpec:
-					iiEntry := importInfo{
-						path: strings.Trim(x.Path.Value, `"`),
-					}
-					if x.Name != nil {
-						iiEntry.alias = x.Name.Name
-					}
-					ii = append(ii, iiEntry)
 				case *ast.TypeSpec:
 					obj := pkg.TypesInfo.ObjectOf(x.Name)
 					if obj == nil {
 						return true
 					}
+					if tg.registerLocalType(obj) && !tg.includeLocalTypes {
+						return true
+					}
 					added := tg.addToNodes(obj)
 					if !added {
 						return true
 					}
 
-					tg.buildEdge(x, pkg.TypesInfo, obj, ii)
+					tg.buildEdge(x, pkg.TypesInfo, obj)
+				case *ast.ValueSpec:
+					tg.registerFuncLitScopes(x, pkg.TypesInfo)
+					tg.buildVarEdge(x, pkg.TypesInfo)
+				case *ast.FuncDecl:
+					if scope, ok := pkg.TypesInfo.Scopes[x.Type]; ok {
+						tg.funcScopes[scope] = funcName(x)
+					}
+					tg.buildReceiverMethodEdge(x, pkg.TypesInfo)
+					if tg.includeFuncs {
+						tg.buildFuncEdge(x, pkg.TypesInfo)
+					}
+					bodies = append(bodies, funcBody{decl: x, info: pkg.TypesInfo, fset: pkg.Fset})
 				}
 				return true
 			})
@@ -403,6 +1377,37 @@ func (tg *TypeGraph) Build(path string) error {
 	}
 
 	tg.buildImplementsEdge()
+	for _, body := range bodies {
+		if tg.includeConstructs || tg.includeAsserts {
+			tg.buildBodyEdge(body.decl, body.info)
+		}
+		if tg.includeUsedAs {
+			sig, _ := body.info.ObjectOf(body.decl.Name).Type().(*types.Signature)
+			tg.buildUsedAsEdge(body.decl.Body, sig, body.info, body.fset)
+		}
+		if tg.errorView {
+			tg.buildReturnsErrorEdge(body.decl, body.info)
+		}
+	}
+	if tg.errorView {
+		tg.markErrorTypes()
+		tg.buildWrapsEdge()
+	}
+	// After the bodies, because the external interfaces referenced only
+	// in the bodies are found there.
+	if tg.externalImplements {
+		err = tg.buildExternalImplementsEdge(pkgs)
+		if err != nil {
+			return err
+		}
+	}
+	if tg.includeCalls {
+		tg.buildCallsEdge(pkgs)
+	}
+	if tg.externalDepth != 1 {
+		tg.expandThirdParty()
+	}
+	tg.pruneThirdParty()
 
 	return nil
 }
@@ -412,8 +1417,8 @@ func (tg *TypeGraph) StructNodes() map[string]([]string) {
 
 	for pkg, structs := range tg.pkgToStructs {
 		nodes[pkg] = []string{}
-		for _, s := range structs {
-			nodes[pkg] = append(nodes[pkg], s.Name())
+		for name := range structs {
+			nodes[pkg] = append(nodes[pkg], name)
 		}
 	}
 
@@ -427,8 +1432,8 @@ func (tg *TypeGraph) InterfaceNodes() map[string]([]string) {
 		if _, ok := nodes[pkg]; !ok {
 			nodes[pkg] = []string{}
 		}
-		for _, i := range interfaces {
-			nodes[pkg] = append(nodes[pkg], i.Name())
+		for name := range interfaces {
+			nodes[pkg] = append(nodes[pkg], name)
 		}
 	}
 
@@ -442,14 +1447,128 @@ func (tg *TypeGraph) OtherNodes() map[string]([]string) {
 		if _, ok := nodes[pkg]; !ok {
 			nodes[pkg] = []string{}
 		}
-		for _, i := range others {
-			nodes[pkg] = append(nodes[pkg], i.Name())
+		for name := range others {
+			nodes[pkg] = append(nodes[pkg], name)
+		}
+	}
+
+	return nodes
+}
+
+func (tg *TypeGraph) FuncNodes() map[string]([]string) {
+	nodes := map[string]([]string){}
+
+	for pkg, funcs := range tg.pkgToFuncs {
+		if _, ok := nodes[pkg]; !ok {
+			nodes[pkg] = []string{}
+		}
+		for name := range funcs {
+			nodes[pkg] = append(nodes[pkg], name)
+		}
+	}
+
+	return nodes
+}
+
+func (tg *TypeGraph) VarNodes() map[string]([]string) {
+	nodes := map[string]([]string){}
+
+	for pkg, vars := range tg.pkgToVars {
+		if _, ok := nodes[pkg]; !ok {
+			nodes[pkg] = []string{}
+		}
+		for name := range vars {
+			nodes[pkg] = append(nodes[pkg], name)
 		}
 	}
 
 	return nodes
 }
 
+// UsedAsSites returns the positions of the conversions from the type from
+// to the interface to, found for a UsedAs edge. They are in the source order.
+func (tg *TypeGraph) UsedAsSites(from, to string) []string {
+	return append([]string{}, tg.usedAsSites[from][to]...)
+}
+
+// IncidentalImplementations returns the incidental Implements edges
+// toward the interfaces in the module, sorted by the "from" and "to" IDs.
+// They are the candidates for a compile-time assertion.
+func (tg *TypeGraph) IncidentalImplementations() [][2]string {
+	ret := [][2]string{}
+	for from, edges := range tg.edges {
+		for edge := range edges {
+			if edge.Kind != Implements || edge.Asserted {
+				continue
+			}
+			if !tg.isInternalPath(tg.idToPkg[edge.To]) {
+				continue
+			}
+			_, fromConstraint := tg.constraintNodes[from]
+			_, toConstraint := tg.constraintNodes[edge.To]
+			if fromConstraint || toConstraint || !tg.isMethodSetInterface(edge.To) {
+				// Constraints cannot be asserted with a variable.
+				continue
+			}
+			ret = append(ret, [2]string{from, edge.To})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i][0] != ret[j][0] {
+			return ret[i][0] < ret[j][0]
+		}
+		return ret[i][1] < ret[j][1]
+	})
+	return ret
+}
+
+// isConstraintNode returns true if obj is synthesized from an inline constraint.
+func (tg *TypeGraph) isConstraintNode(obj types.Object) bool {
+	_, ok := tg.constraintNodes[tg.typeID(obj)]
+	return ok
+}
+
+func (tg *TypeGraph) isMethodSetInterface(id string) bool {
+	for _, i := range tg.pkgToInterfaces[tg.idToPkg[id]] {
+		if tg.typeID(i) != id {
+			continue
+		}
+		typedI, ok := i.Type().Underlying().(*types.Interface)
+		return ok && typedI.IsMethodSet()
+	}
+	return false
+}
+
+// LocalTypes returns the map from the IDs of function-local type nodes
+// to the names of their enclosing functions.
+func (tg *TypeGraph) LocalTypes() map[string]string {
+	ret := map[string]string{}
+	for obj, f := range tg.localTypes {
+		ret[tg.typeID(obj)] = f
+	}
+	return ret
+}
+
+// PredeclaredNodes returns the set of the predeclared types which are edge targets.
+// They do not belong to any package.
+func (tg *TypeGraph) PredeclaredNodes() map[string]struct{} {
+	ret := map[string]struct{}{}
+	for id := range tg.predeclaredNodes {
+		ret[id] = struct{}{}
+	}
+	return ret
+}
+
+// TestNodes returns the set of the IDs of the nodes declared in the test files
+// and in the external test packages.
+func (tg *TypeGraph) TestNodes() map[string]struct{} {
+	ret := map[string]struct{}{}
+	for id := range tg.testNodes {
+		ret[id] = struct{}{}
+	}
+	return ret
+}
+
 func (tg *TypeGraph) Edges() map[string](map[Edge]struct{}) {
 	ret := map[string](map[Edge]struct{}){}
 	for from, edges := range tg.edges {
@@ -461,40 +1580,106 @@ func (tg *TypeGraph) Edges() map[string](map[Edge]struct{}) {
 	return ret
 }
 
+// Imports returns the map from the path of each loaded package
+// to the paths of the packages imported by it.
+func (tg *TypeGraph) Imports() map[string]([]string) {
+	ret := map[string]([]string){}
+	for pkg, imports := range tg.imports {
+		ret[pkg] = []string{}
+		for imp := range imports {
+			ret[pkg] = append(ret[pkg], imp)
+		}
+	}
+	return ret
+}
+
+// PackageEdge is an edge between packages
+// which aggregates the edges between the types in them.
+type PackageEdge struct {
+	To   string
+	Kind EdgeKind
+}
+
+// PackageEdges returns the edges between packages with the number of
+// the edges between the types in them for each edge kind.
+// The edges within a package are ignored.
+func (tg *TypeGraph) PackageEdges() map[string](map[PackageEdge]int) {
+	ret := map[string](map[PackageEdge]int){}
+	for from, edges := range tg.edges {
+		fromPkg, ok := tg.idToPkg[from]
+		if !ok {
+			continue
+		}
+		for edge := range edges {
+			toPkg, ok := tg.idToPkg[edge.To]
+			if !ok || toPkg == fromPkg {
+				continue
+			}
+			if _, ok := ret[fromPkg]; !ok {
+				ret[fromPkg] = map[PackageEdge]int{}
+			}
+			ret[fromPkg][PackageEdge{
+				To:   toPkg,
+				Kind: edge.Kind,
+			}]++
+		}
+	}
+	return ret
+}
+
 func (tg *TypeGraph) Dump() {
 	fmt.Println("struct nodes:")
 	for pkg, str := range tg.pkgToStructs {
 		fmt.Printf("  pkg: %s\n", pkg)
-		for _, s := range str {
+		for name := range str {
 			fmt.Print("    ")
-			fmt.Println(s.Name())
+			fmt.Println(name)
 		}
 	}
 
 	fmt.Println("interface nodes:")
 	for pkg, ifc := range tg.pkgToInterfaces {
 		fmt.Printf("  pkg: %s\n", pkg)
-		for _, s := range ifc {
+		for name := range ifc {
 			fmt.Print("    ")
-			fmt.Println(s.Name())
+			fmt.Println(name)
 		}
 	}
 
 	fmt.Println("other nodes:")
 	for pkg, others := range tg.pkgToOthers {
 		fmt.Printf("  pkg: %s\n", pkg)
-		for _, o := range others {
+		for name := range others {
+			fmt.Print("    ")
+			fmt.Println(name)
+		}
+	}
+
+	fmt.Println("func nodes:")
+	for pkg, funcs := range tg.pkgToFuncs {
+		fmt.Printf("  pkg: %s\n", pkg)
+		for name := range funcs {
+			fmt.Print("    ")
+			fmt.Println(name)
+		}
+	}
+
+	fmt.Println("var nodes:")
+	for pkg, vars := range tg.pkgToVars {
+		fmt.Printf("  pkg: %s\n", pkg)
+		for name := range vars {
 			fmt.Print("    ")
-			fmt.Println(o.Name())
+			fmt.Println(name)
 		}
 	}
 
 	fmt.Println("edges:")
 	for from, edges := range tg.edges {
 		fmt.Printf("  from: %s\n", from)
-		fmt.Println("  to, kind:")
+		fmt.Println("  to, kind, label, field, multiplicity, pointerOnly, asserted, via:")
 		for edge, _ := range edges {
-			fmt.Printf("    %s, %d\n", edge.To, edge.Kind)
+			fmt.Printf("    %s, %d, %s, %s, %d, %t, %t, %s\n", edge.To, edge.Kind, edge.Label,
+				edge.Field, edge.Multiplicity, edge.PointerOnly, edge.Asserted, edge.Via)
 		}
 	}
 }
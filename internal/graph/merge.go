@@ -0,0 +1,160 @@
+package graph
+
+import (
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Merge merges the graphs built for each platform into one graph.
+// The nodes and the edges found only on some of the platforms
+// are annotated with those platforms.
+func Merge(platforms []string, graphs []*TypeGraph) *TypeGraph {
+	if len(graphs) == 0 {
+		return nil
+	}
+	merged := *graphs[0]
+	merged.pkgToStructs = map[string](map[string]types.Object){}
+	merged.pkgToInterfaces = map[string](map[string]types.Object){}
+	merged.pkgToOthers = map[string](map[string]types.Object){}
+	merged.pkgToFuncs = map[string](map[string]types.Object){}
+	merged.pkgToVars = map[string](map[string]types.Object){}
+	merged.edges = map[string](map[Edge]struct{}){}
+	merged.localTypes = map[types.Object]string{}
+	merged.localNames = map[types.Object]string{}
+	merged.idToPkg = map[string]string{}
+	merged.imports = map[string](map[string]struct{}){}
+	merged.usedAsSites = map[string](map[string]([]string)){}
+	merged.testNodes = map[string]struct{}{}
+	merged.errorNodes = map[string]struct{}{}
+	merged.pkgModules = map[string]*packages.Module{}
+	merged.loadedPkgs = map[string]struct{}{}
+	merged.referencedNodes = map[string]types.Object{}
+	merged.constraintNodes = map[string]struct{}{}
+	merged.predeclaredNodes = map[string]struct{}{}
+	merged.modules = []string{}
+	merged.nodePlatforms = map[string]([]string){}
+	merged.edgePlatforms = map[string](map[Edge]([]string)){}
+
+	for i, g := range graphs {
+		platform := platforms[i]
+		for _, pair := range [][2]map[string](map[string]types.Object){
+			{merged.pkgToStructs, g.pkgToStructs},
+			{merged.pkgToInterfaces, g.pkgToInterfaces},
+			{merged.pkgToOthers, g.pkgToOthers},
+			{merged.pkgToFuncs, g.pkgToFuncs},
+			{merged.pkgToVars, g.pkgToVars},
+		} {
+			for pkg, nodes := range pair[1] {
+				if pair[0][pkg] == nil {
+					pair[0][pkg] = map[string]types.Object{}
+				}
+				for name, obj := range nodes {
+					id := g.typeID(obj)
+					if _, ok := pair[0][pkg][name]; !ok {
+						pair[0][pkg][name] = obj
+					}
+					if !slices.Contains(merged.nodePlatforms[id], platform) {
+						merged.nodePlatforms[id] = append(merged.nodePlatforms[id], platform)
+					}
+				}
+			}
+		}
+		for from, edges := range g.edges {
+			if merged.edgePlatforms[from] == nil {
+				merged.edgePlatforms[from] = map[Edge]([]string){}
+			}
+			for edge := range edges {
+				merged.addEdge(from, edge)
+				merged.edgePlatforms[from][edge] = append(merged.edgePlatforms[from][edge], platform)
+			}
+		}
+		for obj, f := range g.localTypes {
+			merged.localTypes[obj] = f
+		}
+		for obj, name := range g.localNames {
+			merged.localNames[obj] = name
+		}
+		for id, pkg := range g.idToPkg {
+			merged.idToPkg[id] = pkg
+		}
+		for pkg, imps := range g.imports {
+			if merged.imports[pkg] == nil {
+				merged.imports[pkg] = map[string]struct{}{}
+			}
+			for imp := range imps {
+				merged.imports[pkg][imp] = struct{}{}
+			}
+		}
+		for from, toToSites := range g.usedAsSites {
+			if merged.usedAsSites[from] == nil {
+				merged.usedAsSites[from] = map[string]([]string){}
+			}
+			for to, sites := range toToSites {
+				for _, site := range sites {
+					if !slices.Contains(merged.usedAsSites[from][to], site) {
+						merged.usedAsSites[from][to] = append(merged.usedAsSites[from][to], site)
+					}
+				}
+			}
+		}
+		for id := range g.testNodes {
+			merged.testNodes[id] = struct{}{}
+		}
+		for id := range g.errorNodes {
+			merged.errorNodes[id] = struct{}{}
+		}
+		for pkg := range g.loadedPkgs {
+			merged.loadedPkgs[pkg] = struct{}{}
+		}
+		for id, obj := range g.referencedNodes {
+			merged.referencedNodes[id] = obj
+		}
+		for id := range g.constraintNodes {
+			merged.constraintNodes[id] = struct{}{}
+		}
+		for id := range g.predeclaredNodes {
+			merged.predeclaredNodes[id] = struct{}{}
+		}
+		for pkg, m := range g.pkgModules {
+			merged.pkgModules[pkg] = m
+		}
+		for _, module := range g.modules {
+			if !slices.Contains(merged.modules, module) {
+				merged.modules = append(merged.modules, module)
+			}
+		}
+	}
+
+	// Found on all the platforms. No need to annotate.
+	for id, ps := range merged.nodePlatforms {
+		if len(ps) == len(platforms) {
+			delete(merged.nodePlatforms, id)
+		}
+	}
+	for from, edges := range merged.edgePlatforms {
+		for edge, ps := range edges {
+			if len(ps) == len(platforms) {
+				delete(edges, edge)
+			}
+		}
+		if len(edges) == 0 {
+			delete(merged.edgePlatforms, from)
+		}
+	}
+
+	return &merged
+}
+
+// NodePlatforms returns the platforms on which the node id is found.
+// If it is found on all the platforms, return nil.
+func (tg *TypeGraph) NodePlatforms(id string) []string {
+	return tg.nodePlatforms[id]
+}
+
+// EdgePlatforms returns the platforms on which the edge is found.
+// If it is found on all the platforms, return nil.
+func (tg *TypeGraph) EdgePlatforms(from string, edge Edge) []string {
+	return tg.edgePlatforms[from][edge]
+}
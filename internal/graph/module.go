@@ -0,0 +1,292 @@
+package graph
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+// findModules returns the paths of the modules regarded as internal.
+// They are the main modules of the loaded packages
+// and all the modules used in the go.work workspace, if any.
+func findModules(dir string, pkgs []*packages.Package) ([]string, error) {
+	modules := []string{}
+	seen := map[string]struct{}{}
+	add := func(module string) {
+		if _, ok := seen[module]; ok {
+			return
+		}
+		seen[module] = struct{}{}
+		modules = append(modules, module)
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Module != nil && pkg.Module.Main {
+			add(pkg.Module.Path)
+		}
+	}
+
+	workspaceModules, err := findWorkspaceModules(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range workspaceModules {
+		add(module)
+	}
+	return modules, nil
+}
+
+// findWorkspaceModules returns the paths of the modules used in the go.work
+// file which is effective in dir. If there is no such file, return nil.
+func findWorkspaceModules(dir string) ([]string, error) {
+	cmd := exec.Command("go", "env", "GOWORK")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	goWork := strings.TrimSpace(string(out))
+	if goWork == "" || goWork == "off" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(goWork)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := modfile.ParseWork(goWork, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	modules := []string{}
+	for _, use := range wf.Use {
+		modDir := use.Path
+		if !filepath.IsAbs(modDir) {
+			modDir = filepath.Join(filepath.Dir(goWork), modDir)
+		}
+		goMod, err := os.ReadFile(filepath.Join(modDir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, modfile.ModulePath(goMod))
+	}
+	return modules, nil
+}
+
+// findPkgModules returns the map from the path of each package in the
+// dependency graph of patterns to the module it belongs to.
+// The value is nil for the packages in the standard library.
+// Only the metadata is loaded, so that the dependencies are not type-checked.
+func findPkgModules(cfg *packages.Config, patterns []string) (map[string]*packages.Module, error) {
+	metaCfg := *cfg
+	metaCfg.Mode = packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedModule
+	pkgs, err := packages.Load(&metaCfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]*packages.Module{}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		ret[pkg.PkgPath] = pkg.Module
+	})
+	return ret, nil
+}
+
+// isInternalPath returns true if the package pkgPath belongs to
+// one of the internal modules. A module nested in an internal one
+// (e.g. example.com/foo/sub with its own go.mod) is not internal.
+func (tg *TypeGraph) isInternalPath(pkgPath string) bool {
+	if m, ok := tg.pkgModules[pkgPath]; ok {
+		return m != nil && slices.Contains(tg.modules, m.Path)
+	}
+	// Not in the dependency graph. (e.g. loaded for --external-interfaces)
+	for _, module := range tg.modules {
+		if pkgPath == module || strings.HasPrefix(pkgPath, module+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// PackageClass is the class of a package decided by the module it belongs to.
+type PackageClass int
+
+const (
+	// The current module or the modules in the go.work workspace.
+	Internal PackageClass = iota
+	Stdlib
+	ThirdParty
+)
+
+func (c PackageClass) String() string {
+	switch c {
+	case Internal:
+		return "Internal"
+	case Stdlib:
+		return "Stdlib"
+	case ThirdParty:
+		return "ThirdParty"
+	default:
+		return fmt.Sprintf("PackageClass(%d)", int(c))
+	}
+}
+
+// ClassOf returns the class of the package pkgPath.
+// A package in the dependency graph is in the standard library if it
+// belongs to no module. For the other packages, as the go command does,
+// a package is in the standard library if the first element of its path has no dot.
+func (tg *TypeGraph) ClassOf(pkgPath string) PackageClass {
+	if tg.isInternalPath(pkgPath) {
+		return Internal
+	}
+	if m, ok := tg.pkgModules[pkgPath]; ok {
+		if m == nil {
+			return Stdlib
+		}
+		return ThirdParty
+	}
+	first, _, _ := strings.Cut(pkgPath, "/")
+	if !strings.Contains(first, ".") {
+		return Stdlib
+	}
+	return ThirdParty
+}
+
+// expandThirdParty builds the edges from the referenced third-party types
+// to the types in their definitions, so that the types up to externalDepth
+// hops from the internal types are found. The types directly referenced by
+// the loaded packages are 1 hop away, and they are not expanded if externalDepth is 1.
+func (tg *TypeGraph) expandThirdParty() {
+	expanded := map[string]struct{}{}
+	for d := 1; tg.externalDepth < 0 || d < tg.externalDepth; d++ {
+		frontier := []types.Object{}
+		for id, obj := range tg.referencedNodes {
+			if _, ok := expanded[id]; ok {
+				continue
+			}
+			if tg.ClassOf(obj.Pkg().Path()) != ThirdParty {
+				continue
+			}
+			expanded[id] = struct{}{}
+			frontier = append(frontier, obj)
+		}
+		if len(frontier) == 0 {
+			return
+		}
+		for _, obj := range frontier {
+			tg.buildEdgeFromType(obj)
+		}
+	}
+}
+
+// buildEdgeFromType is the same as buildEdge except that it finds the edges
+// from the type information instead of the syntax, which is not loaded for obj.
+func (tg *TypeGraph) buildEdgeFromType(obj types.Object) {
+	if _, ok := obj.Type().(*types.Alias); ok {
+		tg.addEdgesToTypes(findTypeRefsFromType(types.Unalias(obj.Type())), obj, AliasOf, "")
+		return
+	}
+	switch u := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			field := u.Field(i)
+			refs := findTypeRefsFromType(field.Type())
+			if field.Embedded() {
+				tg.addEdgesToTypes(withMultiplicity(refs, One), obj, Embeds, "")
+				continue
+			}
+			for j := range refs {
+				if refs[j].fieldPath == "" {
+					refs[j].fieldPath = field.Name()
+				} else {
+					refs[j].fieldPath = field.Name() + "." + refs[j].fieldPath
+				}
+			}
+			tg.addEdgesToTypes(refs, obj, Has, "")
+		}
+	case *types.Interface:
+		for i := 0; i < u.NumEmbeddeds(); i++ {
+			tg.addEdgesToTypes(findTypeRefsFromType(u.EmbeddedType(i)), obj, Embeds, "")
+		}
+		for i := 0; i < u.NumExplicitMethods(); i++ {
+			m := u.ExplicitMethod(i)
+			sig := m.Type().(*types.Signature)
+			for j := 0; j < sig.Params().Len(); j++ {
+				tg.addEdgesToTypes(findTypeRefsFromType(sig.Params().At(j).Type()), obj, Accepts, m.Name())
+			}
+			for j := 0; j < sig.Results().Len(); j++ {
+				tg.addEdgesToTypes(findTypeRefsFromType(sig.Results().At(j).Type()), obj, Returns, m.Name())
+			}
+		}
+	default:
+		tg.addEdgesToTypes(findTypeRefsFromType(u), obj, DefinedFrom, "")
+	}
+}
+
+// pruneThirdParty removes the types in the third-party modules
+// farther than externalDepth hops from the internal types.
+func (tg *TypeGraph) pruneThirdParty() {
+	if tg.externalDepth < 0 {
+		return
+	}
+
+	// Breadth-first search from all the internal types.
+	dist := map[string]int{}
+	queue := []string{}
+	for from := range tg.edges {
+		if tg.ClassOf(tg.idToPkg[from]) == Internal {
+			dist[from] = 0
+			queue = append(queue, from)
+		}
+	}
+	for len(queue) != 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for edge := range tg.edges[cur] {
+			if _, ok := dist[edge.To]; ok {
+				continue
+			}
+			dist[edge.To] = dist[cur] + 1
+			queue = append(queue, edge.To)
+		}
+	}
+
+	pruned := func(id string) bool {
+		if tg.ClassOf(tg.idToPkg[id]) != ThirdParty {
+			return false
+		}
+		d, ok := dist[id]
+		return !ok || d > tg.externalDepth
+	}
+	for from, edges := range tg.edges {
+		if pruned(from) {
+			delete(tg.edges, from)
+			continue
+		}
+		for edge := range edges {
+			if pruned(edge.To) {
+				delete(edges, edge)
+			}
+		}
+	}
+	for _, pkgToNodes := range []map[string](map[string]types.Object){
+		tg.pkgToStructs, tg.pkgToInterfaces, tg.pkgToOthers, tg.pkgToFuncs, tg.pkgToVars,
+	} {
+		for pkg, nodes := range pkgToNodes {
+			for name, obj := range nodes {
+				if pruned(tg.typeID(obj)) {
+					delete(nodes, name)
+				}
+			}
+			if len(nodes) == 0 {
+				delete(pkgToNodes, pkg)
+			}
+		}
+	}
+}
@@ -9,11 +9,17 @@ import (
 )
 
 var _ t2.IF1 = (*ST3)(nil)
+var _ ioalias.Reader = (*ST8)(nil)
+var _ t2.IF3 = AliasForST1{}
 
 type ST1 struct {
 	a int
 }
 
+func (s ST1) Op4() int {
+	return s.a
+}
+
 type ST2 struct {
 	st3 ST3
 	t   time.Duration
@@ -60,3 +66,103 @@ func (s *ST3) Op2(a int) int {
 func (s *ST3) Op3(o ...t2.ST200) {
 	return
 }
+
+func (s *ST8) Read(p []byte) (int, error) {
+	return s.w.Read(p)
+}
+
+func (s ST4) String() string {
+	return s.b
+}
+
+func (s *ST7) Next() *ST8 {
+	return s.st8
+}
+
+func NewST7(st8 *ST8) *ST7 {
+	return &ST7{st8: st8}
+}
+
+type ST9 struct {
+	cfg struct {
+		st1 *ST1
+		log interface {
+			Write(st2 ST2)
+		}
+	}
+}
+
+func (s *ST2) Run() int {
+	return s.st3.Op1(1, 2)
+}
+
+var DefaultST7 = NewST7(&ST8{})
+
+const DefaultDuration time.Duration = 3
+
+func (s *ST8) Close() error {
+	if c, ok := s.w.(ioalias.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *ST5) Weight(i t2.IF1) int {
+	switch v := i.(type) {
+	case *ST3:
+		return len(v.st4)
+	case nil:
+		return 0
+	}
+	return s.c
+}
+
+func (s *ST5) Default() t2.IF1 {
+	st3 := &ST3{}
+	s.Weight(st3)
+	return st3
+}
+
+type ErrNotFound struct {
+	key string
+}
+
+func (e *ErrNotFound) Error() string {
+	return e.key
+}
+
+type ErrWrapped struct {
+	op    string
+	cause error
+}
+
+func (e ErrWrapped) Error() string {
+	return e.op + ": " + e.cause.Error()
+}
+
+func (e ErrWrapped) Unwrap() error {
+	return e.cause
+}
+
+func (s *ST6) Get(key string) (*ST7, error) {
+	st7, ok := s.st7[key]
+	if !ok {
+		return nil, ErrWrapped{op: "get", cause: &ErrNotFound{key: key}}
+	}
+	return st7, nil
+}
+
+type AliasForST1 = ST1
+
+func (s *ST5) Op3() t2.IF3 {
+	return AliasForST1{a: s.c}
+}
+
+type AliasForErrNotFound = ErrNotFound
+
+func (s *ST6) Lookup(key string) error {
+	if _, ok := s.st7[key]; !ok {
+		return &AliasForErrNotFound{key: key}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package t2_test
+
+import (
+	"github.com/peng225/silkroad/testdata/t2"
+)
+
+type mockIF3 struct {
+	st200 t2.ST200
+}
+
+func (m *mockIF3) Op4() int {
+	return 0
+}
@@ -17,3 +17,56 @@ type IF1 interface {
 type IF2 interface {
 	IF1
 }
+
+type IF3 interface {
+	Op4() int
+}
+
+type ST202 struct {
+	a int
+}
+
+func (s ST202) Op4() int {
+	return s.a
+}
+
+type FuncForIF3 func() int
+
+func (f FuncForIF3) Op4() int {
+	return f()
+}
+
+func (s ST202) Op5() int {
+	type result struct {
+		st200 ST200
+	}
+	r := result{}
+	return r.st200.a
+}
+
+func Op6() {
+	type result struct {
+		st202 ST202
+	}
+	_ = result{}
+}
+
+func Op7(flag bool) int {
+	if flag {
+		type tmp struct {
+			st200 ST200
+		}
+		return tmp{}.st200.a
+	}
+	type tmp struct {
+		st202 ST202
+	}
+	return tmp{}.st202.a
+}
+
+var Op8 = func() int {
+	type res struct {
+		st200 ST200
+	}
+	return res{}.st200.a
+}
@@ -0,0 +1,21 @@
+package t2
+
+type fakeIF3 struct {
+	n int
+}
+
+func (f *fakeIF3) Op4() int {
+	return f.n
+}
+
+type fakeIF1 struct{}
+
+func (f fakeIF1) Op1(a, b int) int {
+	return a
+}
+
+func (f fakeIF1) Op2(a int) int {
+	return a
+}
+
+func (f fakeIF1) Op3(o ...ST200) {}
@@ -63,3 +63,41 @@ type ST106 struct {
 	f AliasForFunc
 	l AliasForChanInt
 }
+
+type IF101 interface {
+	~int | ~string
+}
+
+type ST107[K comparable, V ~int | ~string, W IF101] struct {
+	m map[K]V
+	w W
+}
+
+type ST108 struct {
+	a ST107[string, AliasForInt, int]
+}
+
+func (s *ST105) Reset() {
+	s.g = ST101[t11.ST3]{}
+	s.h = *new(ST104[int])
+}
+
+func (s *ST106) Open() {
+	s.l = make(AliasForChanInt, 1)
+	_ = Alias2ForST100{}
+	_ = new(Alias2ForST100)
+}
+
+type ST109 struct {
+	ST104[int]
+}
+
+type AliasForST101 = ST101[ST100]
+
+func (s *ST109) Get() ST101[ST100] {
+	return ST101[ST100]{}
+}
+
+type ST110[T interface{ Reset() }] struct {
+	t T
+}
@@ -0,0 +1,20 @@
+package t4
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+
+	. "github.com/peng225/silkroad/testdata/t2"
+)
+
+type ST400 struct {
+	st200 ST200
+	tmpl  *template.Template
+	cmd   *cobra.Command
+}
+
+func (s *ST400) Name() string {
+	return strings.ToUpper(s.tmpl.Name())
+}
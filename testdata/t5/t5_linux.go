@@ -0,0 +1,13 @@
+package t5
+
+type Backend struct {
+	fd uintptr
+}
+
+type Syncer interface {
+	Sync() error
+}
+
+func (b *Backend) Sync() error {
+	return nil
+}
@@ -0,0 +1,5 @@
+//go:build !linux && !windows
+
+package t5
+
+type Backend struct{}
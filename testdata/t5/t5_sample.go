@@ -0,0 +1,5 @@
+package t5
+
+type Storage struct {
+	backend Backend
+}
@@ -0,0 +1,7 @@
+//go:build tracing
+
+package t5
+
+type Tracer struct {
+	storage *Storage
+}
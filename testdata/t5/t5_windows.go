@@ -0,0 +1,5 @@
+package t5
+
+type Backend struct {
+	handle uintptr
+}